@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestRejectTrailingFlags(t *testing.T) {
+	flags := []cli.Flag{&VarFlag, &DryFlag, &JobsFlag}
+	tests := []struct {
+		name  string
+		args  []string
+		error string
+	}{
+		{name: "no flags", args: []string{"build"}},
+		{name: "recipe flag", args: []string{"build", "-v", "--verbose=true"}},
+		{name: "bake flag", args: []string{"build", "-var", "name=value"}, error: `flag "-var" must be placed before "build"; use "--" to pass it to the recipes`},
+		{name: "bake flag with value", args: []string{"build", "--dry=true"}, error: `flag "--dry=true" must be placed before "build"; use "--" to pass it to the recipes`},
+		{name: "bake alias", args: []string{"build", "-j", "2"}, error: `flag "-j" must be placed before "build"; use "--" to pass it to the recipes`},
+		{name: "bake flag for the recipes", args: []string{"build", "--", "-dry"}},
+		{name: "recipe flag named as a value", args: []string{"build", "var"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// act
+			err := rejectTrailingFlags(test.args, flags)
+
+			// assert
+			if test.error == "" && err != nil {
+				t.Fatal(err)
+			}
+
+			if test.error != "" && (err == nil || err.Error() != test.error) {
+				t.Errorf(`expected "%s" but got %v`, test.error, err)
+			}
+		})
+	}
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"bake/internal"
+	"bake/internal/event"
+	"bake/internal/graph"
 	"bake/internal/info"
 	"bake/internal/lang/config"
+	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
@@ -59,8 +64,10 @@ func do(ctx context.Context) (hcl.DiagnosticWriter, error) {
 		Compiled: time.Now(),
 		Version:  info.Version,
 		Commands: []*cli.Command{{
-			Name:  "list",
-			Usage: "lists all public tasks; those that have a description",
+			Name:   "list",
+			Usage:  "lists all public tasks; those that have a description",
+			Flags:  []cli.Flag{&VarFlag},
+			Before: parseVariables(state),
 			Action: func(c *cli.Context) error {
 				// read bake files in the cwd
 				tasks, err := internal.GetPublicTasks(state, parser)
@@ -78,25 +85,234 @@ func do(ctx context.Context) (hcl.DiagnosticWriter, error) {
 			Name:  "run",
 			Usage: "runs the provided task from bake files",
 			Flags: []cli.Flag{
+				&VarFlag,
 				&DryFlag,
 				&ForceFlag,
 				&PruneFlag,
+				&JobsFlag,
+				&KeepGoingFlag,
+				&OutputFlag,
+				&JUnitFlag,
+				&TraceFlag,
 			},
+			Before: parseVariables(state),
 			Action: func(c *cli.Context) error {
 				task := c.Args().Get(0)
 				if task == "" {
 					return cli.ShowCommandHelp(c, c.Command.Name)
 				}
 
-				state.Flags, err = config.NewStateFlags(c.Bool(Dry), c.Bool(Prune), c.Bool(Force))
+				state.Flags, err = config.NewStateFlags(c.Bool(Dry), c.Bool(Prune), c.Bool(Force), c.Bool(KeepGoing), c.String(Output))
 				if err != nil {
 					return err
 				}
 
-				start := time.Now()
+				if state.Flags.Output == config.OutputJSON {
+					state.Events.Subscribe(event.NewJSON(os.Stdout))
+				} else {
+					state.Events.Subscribe(event.NewText(os.Stdout, log))
+				}
+
+				if c.IsSet(Jobs) {
+					state.Jobs, err = config.NewJobs(c.Int(Jobs))
+					if err != nil {
+						return err
+					}
+				}
+
+				junit := event.NewJUnit()
+				if c.IsSet(JUnit) {
+					state.Events.Subscribe(junit)
+				}
+
+				trace := event.NewTrace()
+				if c.IsSet(Trace) {
+					state.Events.Subscribe(trace)
+				}
+
 				diags := internal.Do(task, state, parser)
-				end := time.Now()
-				fmt.Printf("\ndone in %s\n", end.Sub(start).String())
+				if c.IsSet(Trace) {
+					err := trace.WriteFile(c.String(Trace))
+					if err != nil {
+						return fmt.Errorf("error writing trace: %w", err)
+					}
+				}
+
+				if c.IsSet(JUnit) {
+					err := junit.WriteFile(c.String(JUnit))
+					if err != nil {
+						return fmt.Errorf("error writing junit report: %w", err)
+					}
+				}
+
+				if diags.HasErrors() {
+					// already reported through the events
+					return cli.Exit("", 2)
+				}
+
+				return nil
+			},
+		}, {
+			Name:      "graph",
+			Usage:     "prints the dependency graph of the provided task or of all tasks",
+			ArgsUsage: "[task]",
+			Flags: []cli.Flag{
+				&VarFlag,
+				&FormatFlag,
+				&ExpandFlag,
+				&StaleFlag,
+			},
+			Before: parseVariables(state),
+			Action: func(c *cli.Context) error {
+				result, diags := internal.Graph(c.Args().Get(0), state, parser, c.Bool(Expand), c.Bool(Stale))
+				if diags.HasErrors() {
+					return diags
+				}
+
+				return result.Render(os.Stdout, c.String(Format))
+			},
+		}, {
+			Name:  "affected",
+			Usage: "lists the tasks affected by changes on the provided files; read from stdin unless --files is set",
+			Flags: []cli.Flag{
+				&VarFlag,
+				&FilesFlag,
+				&RunFlag,
+				&JobsFlag,
+				&KeepGoingFlag,
+				&OutputFlag,
+			},
+			Before: parseVariables(state),
+			Action: func(c *cli.Context) error {
+				files := c.StringSlice(Files)
+				if !c.IsSet(Files) {
+					files, err = readLines(os.Stdin)
+					if err != nil {
+						return fmt.Errorf("error reading files from stdin: %w", err)
+					}
+				}
+
+				if !c.Bool(Run) {
+					tasks, diags := internal.Affected(files, state, parser)
+					if diags.HasErrors() {
+						return diags
+					}
+
+					for _, task := range tasks {
+						fmt.Println(task)
+					}
+					return nil
+				}
+
+				state.Flags, err = config.NewStateFlags(false, false, false, c.Bool(KeepGoing), c.String(Output))
+				if err != nil {
+					return err
+				}
+
+				if state.Flags.Output == config.OutputJSON {
+					state.Events.Subscribe(event.NewJSON(os.Stdout))
+				} else {
+					state.Events.Subscribe(event.NewText(os.Stdout, log))
+				}
+
+				if c.IsSet(Jobs) {
+					state.Jobs, err = config.NewJobs(c.Int(Jobs))
+					if err != nil {
+						return err
+					}
+				}
+
+				diags := internal.RunAffected(files, state, parser)
+				if diags.HasErrors() {
+					// already reported through the events
+					return cli.Exit("", 2)
+				}
+
+				return nil
+			},
+		}, {
+			Name:      "explain",
+			Usage:     "explains why the provided task would run; including the dependencies that changed",
+			ArgsUsage: "<task>",
+			Flags:     []cli.Flag{&VarFlag},
+			Before:    parseVariables(state),
+			Action: func(c *cli.Context) error {
+				task := c.Args().Get(0)
+				if task == "" {
+					return cli.ShowCommandHelp(c, c.Command.Name)
+				}
+
+				diags := internal.Explain(task, state, parser, os.Stdout)
+				if diags.HasErrors() {
+					return diags
+				}
+
+				return nil
+			},
+		}, {
+			Name:  "cache",
+			Usage: "inspects the local cache of task outputs",
+			Subcommands: []*cli.Command{{
+				Name:  "list",
+				Usage: "lists all cache entries from the most to the least recently used",
+				Action: func(c *cli.Context) error {
+					entries, err := state.Cache.Local.Entries()
+					if err != nil {
+						return err
+					}
+
+					total := int64(0)
+					for _, entry := range entries {
+						total += entry.Size
+						fmt.Printf("%s\t%d\t%s\n", entry.Key, entry.Size, entry.LastUsed.Format(time.RFC3339))
+					}
+
+					fmt.Printf("\n%d entries using %d bytes\n", len(entries), total)
+					return nil
+				},
+			}, {
+				Name:  "clear",
+				Usage: "removes all cache entries",
+				Action: func(c *cli.Context) error {
+					return state.Cache.Local.Clear()
+				},
+			}},
+		}, {
+			Name:  "watch",
+			Usage: "runs the provided task and runs it again whenever its sources change",
+			Flags: []cli.Flag{
+				&VarFlag,
+				&DryFlag,
+				&IntervalFlag,
+				&JobsFlag,
+				&OutputFlag,
+			},
+			Before: parseVariables(state),
+			Action: func(c *cli.Context) error {
+				task := c.Args().Get(0)
+				if task == "" {
+					return cli.ShowCommandHelp(c, c.Command.Name)
+				}
+
+				state.Flags, err = config.NewStateFlags(c.Bool(Dry), false, false, false, c.String(Output))
+				if err != nil {
+					return err
+				}
+
+				if state.Flags.Output == config.OutputJSON {
+					return fmt.Errorf(`"%s" output is only supported by run`, config.OutputJSON)
+				}
+
+				state.Events.Subscribe(event.NewText(os.Stdout, log))
+
+				if c.IsSet(Jobs) {
+					state.Jobs, err = config.NewJobs(c.Int(Jobs))
+					if err != nil {
+						return err
+					}
+				}
+
+				diags := internal.Watch(task, state, parser, c.Duration(Interval), log)
 				if diags.HasErrors() {
 					return diags
 				}
@@ -116,10 +332,21 @@ func do(ctx context.Context) (hcl.DiagnosticWriter, error) {
 }
 
 const (
-	Dry   = "dry"
-	Prune = "prune"
-	Force = "force"
-	// Watch  = "watch" TODO
+	Dry       = "dry"
+	Prune     = "prune"
+	Force     = "force"
+	Interval  = "interval"
+	Jobs      = "jobs"
+	KeepGoing = "keep-going"
+	Output    = "output"
+	JUnit     = "junit"
+	Trace     = "trace"
+	Format    = "format"
+	Expand    = "expand"
+	Stale     = "stale"
+	Files     = "files"
+	Run       = "run"
+	Var       = config.VarFlag
 )
 
 var (
@@ -135,8 +362,135 @@ var (
 		Name:  Force,
 		Usage: "Force the current task to run even if nothing changed",
 	}
+	JobsFlag = cli.IntFlag{
+		Name:    Jobs,
+		Aliases: []string{"j"},
+		Usage:   "Amount of tasks to run in parallel; 0 means one per cpu. Defaults to " + config.JobsEnv + " env var",
+	}
+	KeepGoingFlag = cli.BoolFlag{
+		Name:  KeepGoing,
+		Usage: "Keep running the tasks that don't depend on a failed one",
+	}
+	OutputFlag = cli.StringFlag{
+		Name: Output,
+		Usage: "How to print the output of the tasks: " + strings.Join(event.Modes, ", ") + ". Overrides the output of each task. " +
+			`Use "` + config.OutputJSON + `" to print all events of a run as json lines`,
+	}
+	JUnitFlag = cli.StringFlag{
+		Name:  JUnit,
+		Usage: "Write a JUnit XML report of the run to the provided file",
+	}
+	TraceFlag = cli.StringFlag{
+		Name:  Trace,
+		Usage: "Write a timeline of the run to the provided file; in Chrome Trace Event Format",
+	}
+	FormatFlag = cli.StringFlag{
+		Name:  Format,
+		Usage: "Format of the graph: " + strings.Join(graph.Formats, ", "),
+		Value: graph.Dot,
+	}
+	ExpandFlag = cli.BoolFlag{
+		Name:  Expand,
+		Usage: "Show a node per instance of the tasks and data with for_each",
+	}
+	StaleFlag = cli.BoolFlag{
+		Name:  Stale,
+		Usage: "Highlight the tasks that would run",
+	}
+	FilesFlag = cli.StringSliceFlag{
+		Name:  Files,
+		Usage: "Comma separated list of changed files",
+	}
+	RunFlag = cli.BoolFlag{
+		Name:  Run,
+		Usage: "Run the affected tasks instead of listing them",
+	}
+	VarFlag = cli.GenericFlag{
+		Name:  Var,
+		Usage: "Set the value of a variable, ex: -var name=value. Overrides " + config.VarEnvPrefix + "name env vars and " + config.VarsFileExt + " files",
+		Value: &variables{},
+	}
+	IntervalFlag = cli.DurationFlag{
+		Name:  Interval,
+		Usage: "How often to check the task sources for changes",
+		Value: 500 * time.Millisecond,
+	}
 )
 
+// variables collects every -var flag without splitting their values on commas
+type variables []string
+
+func (v *variables) Set(value string) error {
+	*v = append(*v, value)
+	return nil
+}
+
+func (v *variables) String() string {
+	return strings.Join(*v, " ")
+}
+
+// parseVariables sets the values of the variables from the cli before running the command
+func parseVariables(state *config.State) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		err := rejectTrailingFlags(c.Args().Slice(), c.Command.Flags)
+		if err != nil {
+			return err
+		}
+
+		flags, ok := c.Generic(Var).(*variables)
+		if !ok {
+			return nil
+		}
+
+		values, err := config.VariablesFromFlags(*flags)
+		if err != nil {
+			return err
+		}
+
+		state.VarFlags = values
+		return nil
+	}
+}
+
+// rejectTrailingFlags fails on the flags of the command after the arguments, ex: bake run build
+// -var name=value, since the cli stops parsing flags at the first argument and they would be
+// silently ignored. Any other flag, or anything after "--", is left for the recipes; see process.args
+func rejectTrailingFlags(args []string, flags []cli.Flag) error {
+	names := map[string]bool{}
+	for _, flag := range flags {
+		for _, name := range flag.Names() {
+			names[name] = true
+		}
+	}
+
+	for index, arg := range args {
+		if arg == "--" {
+			return nil
+		}
+
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		if strings.HasPrefix(arg, "-") && index > 0 && names[name] {
+			return fmt.Errorf(`flag "%s" must be placed before "%s"; use "--" to pass it to the recipes`, arg, args[0])
+		}
+	}
+
+	return nil
+}
+
+// readLines returns the non empty lines of r
+func readLines(r io.Reader) ([]string, error) {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
 const panicOutput = `
 !!!!!!!!!!!!!!!!!!!!!!!!!!! BAKE CRASH !!!!!!!!!!!!!!!!!!!!!!!!!!!!
 
@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bake/internal/event"
+	"bake/internal/lang/config"
+	"bake/internal/lang/schema"
+	"bake/internal/module"
+	"bake/internal/module/topo"
+	"bake/internal/paths"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// AffectedRun is the name of the run published to the events when running the affected tasks
+const AffectedRun = "affected"
+
+// Affected returns the names of the tasks whose sources match any of the files together
+// with all the tasks that depend on them; in topological order
+func Affected(files []string, state *config.State, parser *hclparse.Parser) ([]string, hcl.Diagnostics) {
+	addrs, diags := readRecipes(state, parser)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	tasks, diags := affectedTasks(files, state, addrs)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	names := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		names = append(names, config.AddressToString(task))
+	}
+
+	return names, nil
+}
+
+// RunAffected runs only the tasks affected by the files; their dependencies are only
+// applied if they are affected as well
+func RunAffected(files []string, state *config.State, parser *hclparse.Parser) hcl.Diagnostics {
+	start := time.Now()
+	state.Events.Publish(event.Event{Kind: event.RunStarted, Task: AffectedRun})
+	diags := runAffected(files, state, parser)
+	if len(diags) > 0 {
+		state.Events.Publish(event.Event{Kind: event.Diagnostics, Task: AffectedRun, Diagnostics: diags})
+	}
+
+	state.Events.Publish(event.Event{
+		Kind:     event.RunFinished,
+		Task:     AffectedRun,
+		Duration: time.Since(start),
+		Success:  !diags.HasErrors(),
+	})
+	return diags
+}
+
+func runAffected(files []string, state *config.State, parser *hclparse.Parser) hcl.Diagnostics {
+	addrs, diags := readRecipes(state, parser)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	tasks, diags := affectedTasks(files, state, addrs)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	selection := make([]cty.Path, 0, len(tasks))
+	for _, task := range tasks {
+		selection = append(selection, task.GetPath())
+	}
+
+	coordinator := module.NewCoordinator()
+	coordinator.Select(selection...)
+	_, diags = apply(state, tasks, addrs, coordinator)
+	return diags
+}
+
+// affectedTasks returns the tasks whose sources match any of the files together with
+// all the tasks that depend on them; in topological order
+func affectedTasks(files []string, state *config.State, addrs []config.RawAddress) ([]config.RawAddress, hcl.Diagnostics) {
+	changed := make([]string, 0, len(files))
+	for _, filename := range files {
+		changed = append(changed, relativeTo(state.CWD, filename))
+	}
+
+	sources, diags := decodeSources(state, addrs)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	allDependencies := map[string][]config.RawAddress{}
+	for _, address := range addrs {
+		if schema.IsKnownPrefix(address.GetPath()) {
+			continue
+		}
+
+		dependencies, diags := topo.Dependencies(address, addrs)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		allDependencies[config.AddressToString(address)] = dependencies
+	}
+
+	matched := map[string]bool{}
+	for _, path := range affected(changed, sources, allDependencies) {
+		matched[paths.String(path)] = true
+	}
+
+	// each dependency list is already sorted so appending them in order keeps the result sorted as well
+	result := make([]config.RawAddress, 0)
+	added := map[string]bool{}
+	for _, address := range addrs {
+		name := config.AddressToString(address)
+		if !matched[name] {
+			continue
+		}
+
+		for _, dependency := range allDependencies[name] {
+			dependencyName := config.AddressToString(dependency)
+			if matched[dependencyName] && !added[dependencyName] {
+				added[dependencyName] = true
+				result = append(result, dependency)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// decodeSources of all tasks. Sources might depend on data, locals or for_each so the tasks
+// are decoded but none of them is applied; neither their tools nor their sources are checked
+func decodeSources(state *config.State, addrs []config.RawAddress) (map[string][]string, hcl.Diagnostics) {
+	tasks := make([]config.RawAddress, 0)
+	for _, address := range addrs {
+		if !schema.IsKnownPrefix(address.GetPath()) {
+			tasks = append(tasks, address)
+		}
+	}
+
+	runState, err := state.Fork(state.Context)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "error reading state",
+			Detail:   err.Error(),
+		}}
+	}
+
+	// nobody is interested in the events of decoding the tasks
+	runState.Events = event.NewBus()
+	runState.Flags.Dry = true
+	coordinator := module.NewCoordinator()
+	// an empty selection instead of none, which would select everything
+	coordinator.Select([]cty.Path{}...)
+	actions, diags := coordinator.DoAll(runState, tasks, addrs)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return taskSources(actions), nil
+}
+
+// relativeTo makes filename relative to dir such that it can be matched against the sources
+func relativeTo(dir, filename string) string {
+	if filepath.IsAbs(filename) {
+		relative, err := filepath.Rel(dir, filename)
+		if err == nil {
+			filename = relative
+		}
+	}
+
+	return filepath.ToSlash(filepath.Clean(strings.TrimSpace(filename)))
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"bake/internal/lang/config"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+const affectedRecipe = `
+data "ext" {
+  command = "echo txt"
+}
+
+task "gen" {
+  command = "echo gen >> runs.log"
+  sources = ["src/*.${data.ext.std_out}"]
+  tools   = { probe = "echo probed >> probes.log && echo 1.0" }
+}
+
+task "build" {
+  command    = "echo build >> runs.log"
+  sources    = ["main.go"]
+  depends_on = [gen]
+}
+
+task "docs" {
+  command = "echo docs >> runs.log"
+  sources = ["docs/**/*.md"]
+}
+`
+
+func TestAffected(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{name: "direct match", files: []string{"docs/guide/intro.md"}, want: []string{"docs"}},
+		{name: "transitive dependent", files: []string{"src/a.txt"}, want: []string{"gen", "build"}},
+		{name: "dependent only", files: []string{"main.go"}, want: []string{"build"}},
+		{name: "unmatched", files: []string{"README.md", "src/a.go"}, want: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			chdir(t, t.TempDir())
+			write(t, map[string]string{"main.hcl": affectedRecipe})
+			state, err := config.NewState(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// act
+			got, diags := Affected(test.files, state, hclparse.NewParser())
+
+			// assert
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("expected %v but got %v", test.want, got)
+			}
+
+			// listing them shouldn't check whether they are stale
+			if _, err := os.Stat("probes.log"); err == nil {
+				t.Error("expected no tool to be probed")
+			}
+		})
+	}
+}
+
+func TestRunAffected(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{name: "direct match", files: []string{"docs/guide/intro.md"}, want: []string{"docs"}},
+		{name: "transitive dependent", files: []string{"src/a.txt"}, want: []string{"gen", "build"}},
+		{name: "dependency not affected", files: []string{"main.go"}, want: []string{"build"}},
+		{name: "unmatched", files: []string{"README.md"}, want: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			chdir(t, t.TempDir())
+			write(t, map[string]string{"main.hcl": affectedRecipe})
+			state, err := config.NewState(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// act
+			diags := RunAffected(test.files, state, hclparse.NewParser())
+
+			// assert
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			runs, err := os.ReadFile("runs.log")
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+
+			got := strings.Fields(string(runs))
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("expected %v to run but got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pack writes a compressed archive of filenames (files or directories) relative to cwd
+func pack(w io.Writer, cwd string, filenames []string) error {
+	compressed := gzip.NewWriter(w)
+	archive := tar.NewWriter(compressed)
+	for _, filename := range filenames {
+		root := filepath.Join(cwd, filename)
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() && !info.Mode().IsRegular() {
+				return fmt.Errorf(`"%s" is neither a file nor a directory`, path)
+			}
+
+			name, err := filepath.Rel(cwd, path)
+			if err != nil {
+				return err
+			}
+
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+
+			header.Name = filepath.ToSlash(name)
+			err = archive.WriteHeader(header)
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			_, err = io.Copy(archive, file)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := archive.Close()
+	if err != nil {
+		return err
+	}
+
+	return compressed.Close()
+}
+
+// unpack extracts an archive created by pack into cwd
+func unpack(r io.Reader, cwd string) error {
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer compressed.Close()
+
+	archive := tar.NewReader(compressed)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(cwd, filepath.FromSlash(header.Name))
+		// never write outside of cwd; even if the archive was tampered with
+		if !strings.HasPrefix(path, filepath.Clean(cwd)+string(filepath.Separator)) {
+			return fmt.Errorf(`invalid archive entry "%s"`, header.Name)
+		}
+
+		mode := header.FileInfo().Mode()
+		if header.Typeflag == tar.TypeDir {
+			err = os.MkdirAll(path, mode.Perm()|0700)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		err = os.MkdirAll(filepath.Dir(path), 0770)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(file, archive)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		// keep the original modification time; mostly for mtime based tools
+		err = os.Chtimes(path, header.ModTime, header.ModTime)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrNotFound = errors.New("cache entry not found")
+	ErrReadOnly = errors.New("cache is read only")
+)
+
+// Backend stores cache entries; compressed archives of task outputs, by their key
+type Backend interface {
+	Has(ctx context.Context, key string) (bool, error)
+	// Get returns ErrNotFound if no entry exists for key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Put returns ErrReadOnly if the backend doesn't accept new entries
+	Put(ctx context.Context, key string, entry io.Reader, size int64) error
+}
+
+// Cache restores and saves task outputs through a local backend and an
+// optional remote one. Entries found only remotely are also stored locally
+type Cache struct {
+	Local  *Local
+	remote Backend
+}
+
+// New cache with an optional remote backend; nil if none
+func New(local *Local, remote Backend) *Cache {
+	return &Cache{Local: local, remote: remote}
+}
+
+// Restore the outputs stored for key into cwd. The existing outputs are removed first such
+// that no stale file is left behind. False is returned if no entry exists for key
+func (cache *Cache) Restore(ctx context.Context, key, cwd string, filenames []string) (bool, error) {
+	entry, err := cache.get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+	defer entry.Close()
+
+	for _, filename := range filenames {
+		err = os.RemoveAll(filepath.Join(cwd, filename))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = unpack(entry, cwd)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (cache *Cache) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	entry, err := cache.Local.Get(ctx, key)
+	if !errors.Is(err, ErrNotFound) || cache.remote == nil {
+		return entry, err
+	}
+
+	remote, err := cache.remote.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer remote.Close()
+
+	// keep a local copy to avoid downloading it again
+	err = cache.Local.Put(ctx, key, remote, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	return cache.Local.Get(ctx, key)
+}
+
+// Save the outputs (files or directories relative to cwd) under key
+func (cache *Cache) Save(ctx context.Context, key, cwd string, filenames []string) error {
+	file, err := os.CreateTemp("", "bake-*"+extension)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	err = pack(file, cwd, filenames)
+	if err != nil {
+		return err
+	}
+
+	err = put(ctx, cache.Local, key, file)
+	if err != nil || cache.remote == nil {
+		return err
+	}
+
+	// don't upload entries that the remote already has, ex: saved by another machine
+	has, err := cache.remote.Has(ctx, key)
+	if err != nil || has {
+		return err
+	}
+
+	return put(ctx, cache.remote, key, file)
+}
+
+// put the whole archive into the backend; read only backends are ignored
+func put(ctx context.Context, backend Backend, key string, archive *os.File) error {
+	size, err := archive.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	_, err = archive.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	err = backend.Put(ctx, key, archive, size)
+	if err != nil && !errors.Is(err, ErrReadOnly) {
+		return err
+	}
+
+	return nil
+}
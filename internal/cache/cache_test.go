@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheRoundTrip(t *testing.T) {
+	// arrange
+	cwd := t.TempDir()
+	cache := New(NewLocal(filepath.Join(cwd, ".bake", "cache"), DefaultMaxSize), nil)
+	err := os.MkdirAll(filepath.Join(cwd, "gen", "nested"), 0770)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(cwd, "gen", "nested", "file.txt"), []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// act
+	err = cache.Save(context.Background(), "key", cwd, []string{"gen"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a stale file should not survive the restore
+	err = os.WriteFile(filepath.Join(cwd, "gen", "stale.txt"), []byte("stale"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := cache.Restore(context.Background(), "key", cwd, []string{"gen"})
+	// assert
+	if err != nil || !ok {
+		t.Fatalf("expected entry to be restored: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(cwd, "gen", "nested", "file.txt"))
+	if err != nil || string(content) != "hello" {
+		t.Errorf("expected restored content to be 'hello' but got '%s'", content)
+	}
+
+	if _, err := os.Stat(filepath.Join(cwd, "gen", "stale.txt")); err == nil {
+		t.Error("expected stale file to be removed")
+	}
+
+	ok, err = cache.Restore(context.Background(), "missing", cwd, []string{"gen"})
+	if err != nil || ok {
+		t.Errorf("expected a cache miss but got %v, %v", ok, err)
+	}
+}
+
+func TestLocalEviction(t *testing.T) {
+	// arrange
+	cwd := t.TempDir()
+	dir := filepath.Join(cwd, "cache")
+	err := os.WriteFile(filepath.Join(cwd, "file.txt"), []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = New(NewLocal(dir, DefaultMaxSize), nil).Save(context.Background(), "first", cwd, []string{"file.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := NewLocal(dir, DefaultMaxSize).Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only enough space for a single entry
+	local := NewLocal(dir, entries[0].Size)
+	// act
+	err = New(local, nil).Save(context.Background(), "second", cwd, []string{"file.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert
+	entries, err = local.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Key != "second" {
+		t.Errorf("expected only the most recent entry to be kept but got %v", entries)
+	}
+}
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const (
+	// RemoteURLEnv is the base url of the remote cache; disabled if empty
+	RemoteURLEnv = "BAKE_REMOTE_CACHE_URL"
+	// RemoteReadOnlyEnv only downloads entries from the remote cache if true
+	RemoteReadOnlyEnv = "BAKE_REMOTE_CACHE_READ_ONLY"
+	// RemoteHeaderEnvPrefix for env vars sent as headers to the remote cache; for example
+	// BAKE_REMOTE_CACHE_HEADER_AUTHORIZATION="Bearer ..." sends an Authorization header
+	RemoteHeaderEnvPrefix = "BAKE_REMOTE_CACHE_HEADER_"
+)
+
+// HTTP is a cache Backend that fetches entries with GET and HEAD and stores them
+// with PUT on {url}/{key}.tar.gz. Any static file server serving a directory with
+// the same layout as the local cache can be used as a read only remote
+type HTTP struct {
+	url      string
+	headers  http.Header
+	readOnly bool
+	client   *http.Client
+}
+
+func NewHTTP(url string, headers http.Header, readOnly bool) *HTTP {
+	return &HTTP{
+		url:      strings.TrimSuffix(url, "/"),
+		headers:  headers,
+		readOnly: readOnly,
+		client:   &http.Client{},
+	}
+}
+
+// NewHTTPFromEnv creates a remote backend from the env vars; nil is
+// returned if no remote cache was configured
+func NewHTTPFromEnv(env map[string]string) (*HTTP, error) {
+	url := env[RemoteURLEnv]
+	if url == "" {
+		return nil, nil
+	}
+
+	readOnly := false
+	if value, ok := env[RemoteReadOnlyEnv]; ok {
+		var err error
+		readOnly, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", RemoteReadOnlyEnv, err)
+		}
+	}
+
+	headers := http.Header{}
+	for name, value := range env {
+		if !strings.HasPrefix(name, RemoteHeaderEnvPrefix) {
+			continue
+		}
+
+		header := strings.ReplaceAll(strings.TrimPrefix(name, RemoteHeaderEnvPrefix), "_", "-")
+		headers.Set(textproto.CanonicalMIMEHeaderKey(header), value)
+	}
+
+	return NewHTTP(url, headers, readOnly), nil
+}
+
+func (remote *HTTP) Has(ctx context.Context, key string) (bool, error) {
+	response, err := remote.do(ctx, http.MethodHead, key, nil, 0)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, statusError(http.MethodHead, key, response)
+	}
+}
+
+func (remote *HTTP) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	response, err := remote.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return response.Body, nil
+	case http.StatusNotFound:
+		response.Body.Close()
+		return nil, ErrNotFound
+	default:
+		response.Body.Close()
+		return nil, statusError(http.MethodGet, key, response)
+	}
+}
+
+func (remote *HTTP) Put(ctx context.Context, key string, entry io.Reader, size int64) error {
+	if remote.readOnly {
+		return ErrReadOnly
+	}
+
+	response, err := remote.do(ctx, http.MethodPut, key, entry, size)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return statusError(http.MethodPut, key, response)
+	}
+
+	return nil
+}
+
+func (remote *HTTP) do(ctx context.Context, method, key string, body io.Reader, size int64) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, remote.url+"/"+key+extension, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		request.ContentLength = size
+	}
+
+	for name, values := range remote.headers {
+		request.Header[name] = values
+	}
+
+	return remote.client.Do(request)
+}
+
+func statusError(method, key string, response *http.Response) error {
+	return fmt.Errorf("remote cache %s %s failed with: %s", method, key, response.Status)
+}
@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const token = "Bearer secret"
+
+// fakeRemote is a minimal blob store that only accepts authorized requests
+type fakeRemote struct {
+	mutex sync.Mutex
+	blobs map[string][]byte
+	puts  int
+}
+
+func (remote *fakeRemote) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	remote.mutex.Lock()
+	defer remote.mutex.Unlock()
+	blob, ok := remote.blobs[r.URL.Path]
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Write(blob)
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		remote.puts++
+		remote.blobs[r.URL.Path] = body
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newFakeRemote(t *testing.T) (*fakeRemote, *httptest.Server) {
+	remote := &fakeRemote{blobs: map[string][]byte{}}
+	server := httptest.NewServer(remote)
+	t.Cleanup(server.Close)
+	return remote, server
+}
+
+func TestHTTPBackend(t *testing.T) {
+	// arrange
+	_, server := newFakeRemote(t)
+	backend, err := NewHTTPFromEnv(map[string]string{
+		RemoteURLEnv:                            server.URL + "/cache/",
+		RemoteHeaderEnvPrefix + "AUTHORIZATION": token,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	// act
+	err = backend.Put(ctx, "key", strings.NewReader("content"), int64(len("content")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	has, err := backend.Has(ctx, "key")
+	if err != nil || !has {
+		t.Errorf("expected the entry to exist but got %v, %v", has, err)
+	}
+
+	entry, err := backend.Get(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+
+	content, err := io.ReadAll(entry)
+	// assert
+	if err != nil || string(content) != "content" {
+		t.Errorf("expected 'content' but got '%s': %v", content, err)
+	}
+
+	_, err = backend.Get(ctx, "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a not found error but got %v", err)
+	}
+
+	unauthorized := NewHTTP(server.URL+"/cache", nil, false)
+	_, err = unauthorized.Has(ctx, "key")
+	if err == nil {
+		t.Error("expected an error without authorization header")
+	}
+}
+
+func TestHTTPReadOnly(t *testing.T) {
+	// arrange
+	remote, server := newFakeRemote(t)
+	backend, err := NewHTTPFromEnv(map[string]string{
+		RemoteURLEnv:                            server.URL,
+		RemoteReadOnlyEnv:                       "true",
+		RemoteHeaderEnvPrefix + "AUTHORIZATION": token,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// act
+	err = backend.Put(context.Background(), "key", bytes.NewReader(nil), 0)
+	// assert
+	if !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected a read only error but got %v", err)
+	}
+
+	if remote.puts != 0 {
+		t.Errorf("expected no upload but got %d", remote.puts)
+	}
+}
+
+func TestRemoteRestore(t *testing.T) {
+	// arrange: a machine builds and uploads its outputs
+	_, server := newFakeRemote(t)
+	headers := http.Header{"Authorization": []string{token}}
+	builder := t.TempDir()
+	err := os.WriteFile(filepath.Join(builder, "out.txt"), []byte("built"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	remote := NewHTTP(server.URL, headers, false)
+	err = New(NewLocal(filepath.Join(builder, "cache"), DefaultMaxSize), remote).Save(ctx, "key", builder, []string{"out.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// act: another machine restores them without building
+	consumer := t.TempDir()
+	local := NewLocal(filepath.Join(consumer, "cache"), DefaultMaxSize)
+	ok, err := New(local, remote).Restore(ctx, "key", consumer, []string{"out.txt"})
+	// assert
+	if err != nil || !ok {
+		t.Fatalf("expected the entry to be restored from remote: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(consumer, "out.txt"))
+	if err != nil || string(content) != "built" {
+		t.Errorf("expected restored content to be 'built' but got '%s'", content)
+	}
+
+	has, err := local.Has(ctx, "key")
+	if err != nil || !has {
+		t.Error("expected the remote entry to be stored locally")
+	}
+}
+
+func TestSaveExistingRemote(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing bool
+		puts     int
+	}{
+		{name: "missing entry", existing: false, puts: 1},
+		{name: "existing entry", existing: true, puts: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			remote, server := newFakeRemote(t)
+			if test.existing {
+				remote.blobs["/key"+extension] = []byte("uploaded by another machine")
+			}
+
+			cwd := t.TempDir()
+			err := os.WriteFile(filepath.Join(cwd, "out.txt"), []byte("built"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			backend := NewHTTP(server.URL, http.Header{"Authorization": []string{token}}, false)
+			local := NewLocal(filepath.Join(cwd, "cache"), DefaultMaxSize)
+
+			// act
+			err = New(local, backend).Save(context.Background(), "key", cwd, []string{"out.txt"})
+
+			// assert
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if remote.puts != test.puts {
+				t.Errorf("expected %d uploads but got %d", test.puts, remote.puts)
+			}
+
+			has, err := local.Has(context.Background(), "key")
+			if err != nil || !has {
+				t.Error("expected the entry to be stored locally")
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultMaxSize of the local cache in bytes
+const DefaultMaxSize = 1 << 30
+
+const extension = ".tar.gz"
+
+// Local is a cache Backend that stores task outputs in a directory. Every
+// entry is a compressed archive named after a key computed from the task inputs.
+// Once the cache grows over its max size, the least recently used entries are evicted
+type Local struct {
+	dir     string
+	maxSize int64
+}
+
+type Entry struct {
+	Key      string
+	Size     int64
+	LastUsed time.Time
+}
+
+func NewLocal(dir string, maxSize int64) *Local {
+	return &Local{dir: dir, maxSize: maxSize}
+}
+
+func (local *Local) Has(ctx context.Context, key string) (bool, error) {
+	_, err := os.Stat(local.path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (local *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path := local.path(key)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// keep track of the last usage for eviction
+	now := time.Now()
+	err = os.Chtimes(path, now, now)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Put stores the entry and evicts old ones if necessary
+func (local *Local) Put(ctx context.Context, key string, entry io.Reader, size int64) error {
+	err := os.MkdirAll(local.dir, 0770)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so that a concurrent restore never sees half an archive
+	file, err := os.CreateTemp(local.dir, key+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, entry)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(file.Name(), local.path(key))
+	if err != nil {
+		return err
+	}
+
+	return local.evict()
+}
+
+// Entries in the cache from the most to the least recently used
+func (local *Local) Entries() ([]Entry, error) {
+	files, err := os.ReadDir(local.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0)
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), extension) {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, Entry{
+			Key:      strings.TrimSuffix(file.Name(), extension),
+			Size:     info.Size(),
+			LastUsed: info.ModTime(),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+
+	return entries, nil
+}
+
+// Clear removes all entries from the cache
+func (local *Local) Clear() error {
+	return os.RemoveAll(local.dir)
+}
+
+func (local *Local) evict() error {
+	entries, err := local.Entries()
+	if err != nil {
+		return err
+	}
+
+	size := int64(0)
+	for _, entry := range entries {
+		size += entry.Size
+		if size <= local.maxSize {
+			continue
+		}
+
+		err = os.Remove(local.path(entry.Key))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (local *Local) path(key string) string {
+	return filepath.Join(local.dir, key+extension)
+}
@@ -0,0 +1,127 @@
+package concurrent
+
+import (
+	"context"
+	"time"
+)
+
+// Pool limits the amount of goroutines doing work at the same time. Every slot
+// has an id in [0, size) such that it is possible to tell which one was used
+type Pool struct {
+	slots chan int
+}
+
+func NewPool(size int) *Pool {
+	slots := make(chan int, size)
+	for slot := 0; slot < size; slot++ {
+		slots <- slot
+	}
+
+	return &Pool{slots: slots}
+}
+
+// Acquire blocks until a slot is available or the context is done
+func (pool *Pool) Acquire(ctx context.Context) (int, error) {
+	select {
+	case slot := <-pool.slots:
+		return slot, nil
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	}
+}
+
+// Release the slot so that others can use it
+func (pool *Pool) Release(slot int) {
+	pool.slots <- slot
+}
+
+func (pool *Pool) Size() int {
+	return cap(pool.slots)
+}
+
+// Lease of a slot held by a single goroutine. The slot can be handed back while
+// the goroutine waits, see Sleep, such that others can use it meanwhile
+type Lease struct {
+	pool  *Pool
+	slot  int
+	held  bool
+	since time.Time
+	holds []Hold
+}
+
+// Hold of a slot by a lease since Start for Duration
+type Hold struct {
+	Slot     int
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Lease blocks until a slot is available or the context is done
+func (pool *Pool) Lease(ctx context.Context) (*Lease, error) {
+	slot, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Lease{pool: pool, slot: slot, held: true, since: time.Now()}, nil
+}
+
+// Slot currently held; it might change after sleeping
+func (lease *Lease) Slot() int {
+	return lease.slot
+}
+
+// Release the slot unless it was already released
+func (lease *Lease) Release() {
+	if !lease.held {
+		return
+	}
+
+	lease.held = false
+	lease.holds = append(lease.holds, Hold{Slot: lease.slot, Start: lease.since, Duration: time.Since(lease.since)})
+	lease.pool.Release(lease.slot)
+}
+
+// Holds of the slots so far; the current one lasts until now
+func (lease *Lease) Holds() []Hold {
+	result := append([]Hold{}, lease.holds...)
+	if lease.held {
+		result = append(result, Hold{Slot: lease.slot, Start: lease.since, Duration: time.Since(lease.since)})
+	}
+
+	return result
+}
+
+type leaseKey struct{}
+
+// WithLease returns a copy of ctx carrying the lease of the goroutine using it
+func WithLease(ctx context.Context, lease *Lease) context.Context {
+	return context.WithValue(ctx, leaseKey{}, lease)
+}
+
+// Sleep for duration unless ctx is done first. The lease carried by ctx, if any, is
+// released meanwhile and acquired again afterwards; possibly with a different slot
+func Sleep(ctx context.Context, duration time.Duration) error {
+	lease, ok := ctx.Value(leaseKey{}).(*Lease)
+	if ok {
+		lease.Release()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(duration):
+	}
+
+	if !ok {
+		return nil
+	}
+
+	slot, err := lease.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	lease.slot, lease.held, lease.since = slot, true, time.Now()
+	return nil
+}
@@ -0,0 +1,115 @@
+package concurrent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSleepReleasesLease(t *testing.T) {
+	// arrange
+	pool := NewPool(1)
+	lease, err := pool.Lease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithLease(context.Background(), lease)
+	slept := make(chan error)
+
+	// act
+	go func() {
+		slept <- Sleep(ctx, 200*time.Millisecond)
+	}()
+
+	// assert
+	acquiring, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	slot, err := pool.Acquire(acquiring)
+	if err != nil {
+		t.Fatal("expected the slot to be available while sleeping")
+	}
+
+	pool.Release(slot)
+	err = <-slept
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !lease.held {
+		t.Error("expected the lease to be held after sleeping")
+	}
+}
+
+func TestSleepCancelled(t *testing.T) {
+	// arrange
+	pool := NewPool(1)
+	lease, err := pool.Lease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(WithLease(context.Background(), lease))
+	cancel()
+
+	// act
+	err = Sleep(ctx, time.Minute)
+	lease.Release()
+
+	// assert
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if len(pool.slots) != pool.Size() {
+		t.Errorf("expected %d free slots but got %d", pool.Size(), len(pool.slots))
+	}
+}
+
+func TestLeaseHolds(t *testing.T) {
+	// arrange
+	pool := NewPool(2)
+	lease, err := pool.Lease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithLease(context.Background(), lease)
+	slept := make(chan error)
+	go func() {
+		slept <- Sleep(ctx, 100*time.Millisecond)
+	}()
+
+	// take the slot released by the lease and hand back the other one
+	slot, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool.Release(other)
+	err = <-slept
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// act
+	holds := lease.Holds()
+
+	// assert
+	if len(holds) != 2 {
+		t.Fatalf("expected 2 holds but got %v", holds)
+	}
+
+	if holds[0].Slot != slot || holds[1].Slot == slot {
+		t.Errorf("expected the slot %d to be held first and then the other one but got %v", slot, holds)
+	}
+
+	if holds[1].Start.Before(holds[0].Start.Add(holds[0].Duration + 100*time.Millisecond)) {
+		t.Errorf("expected the second hold to start after sleeping but got %v", holds)
+	}
+}
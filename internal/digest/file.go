@@ -0,0 +1,115 @@
+package digest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File keeps track of the content of a file or directory together with the
+// metadata used to avoid reading it again when nothing changed
+type File struct {
+	ModTime time.Time
+	Size    int64
+	Digest  string
+}
+
+// NewFile computes the digest of filename. The digest of previous is reused as
+// long as the modification time and size of filename didn't change.
+// Directories are hashed recursively
+func NewFile(filename string, previous *File) (File, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return File{}, err
+	}
+
+	if !info.IsDir() {
+		if previous.matches(info.ModTime(), info.Size()) {
+			return *previous, nil
+		}
+
+		sum := sha256.New()
+		err = copyFile(sum, filename)
+		if err != nil {
+			return File{}, err
+		}
+
+		return File{
+			ModTime: info.ModTime(),
+			Size:    info.Size(),
+			Digest:  hex.EncodeToString(sum.Sum(nil)),
+		}, nil
+	}
+
+	// a directory changes whenever any of its entries does
+	modTime, size := info.ModTime(), int64(0)
+	err = filepath.WalkDir(filename, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return File{}, err
+	}
+
+	if previous.matches(modTime, size) {
+		return *previous, nil
+	}
+
+	sum := sha256.New()
+	err = filepath.WalkDir(filename, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		// include the name so that renames are also detected
+		name, err := filepath.Rel(filename, path)
+		if err != nil {
+			return err
+		}
+
+		sum.Write([]byte(filepath.ToSlash(name) + "\x00"))
+		return copyFile(sum, path)
+	})
+	if err != nil {
+		return File{}, err
+	}
+
+	return File{
+		ModTime: modTime,
+		Size:    size,
+		Digest:  hex.EncodeToString(sum.Sum(nil)),
+	}, nil
+}
+
+func (file *File) matches(modTime time.Time, size int64) bool {
+	return file != nil && file.Digest != "" && file.ModTime.Equal(modTime) && file.Size == size
+}
+
+func copyFile(sum hash.Hash, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(sum, file)
+	return err
+}
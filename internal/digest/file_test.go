@@ -0,0 +1,86 @@
+package digest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewFile(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "hello.txt")
+	err := os.WriteFile(filename, []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// act
+	first, err := NewFile(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(time.Minute)
+	err = os.Chtimes(filename, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	touched, err := NewFile(filename, &first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert
+	if touched.Digest != first.Digest {
+		t.Error("expected the digest to ignore modification times")
+	}
+
+	if touched.ModTime.Equal(first.ModTime) {
+		t.Error("expected the modification time to be updated")
+	}
+
+	// same metadata means the previous digest is trusted without reading the file
+	stale := touched
+	stale.Digest = "stale"
+	reused, err := NewFile(filename, &stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reused.Digest != "stale" {
+		t.Errorf("expected the previous digest to be reused but got %s", reused.Digest)
+	}
+}
+
+func TestNewFileDirectory(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := NewFile(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// act
+	err = os.Rename(filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := NewFile(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert
+	if before.Digest == after.Digest {
+		t.Error("expected renaming a file to change the directory digest")
+	}
+}
@@ -0,0 +1,47 @@
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+// Subscriber handles the events published to a bus. Events are handled one at a
+// time and in the order they were published
+type Subscriber interface {
+	Handle(event Event)
+}
+
+// Bus delivers every published event to all its subscribers
+type Bus struct {
+	mutex       sync.Mutex
+	subscribers []Subscriber
+}
+
+func NewBus(subscribers ...Subscriber) *Bus {
+	return &Bus{subscribers: subscribers}
+}
+
+func (bus *Bus) Subscribe(subscriber Subscriber) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	bus.subscribers = append(bus.subscribers, subscriber)
+}
+
+func (bus *Bus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	for _, subscriber := range bus.subscribers {
+		subscriber.Handle(event)
+	}
+}
+
+// Logger publishes the events of a single task
+func (bus *Bus) Logger(task string) *Logger {
+	return &Logger{bus: bus, task: task}
+}
@@ -0,0 +1,74 @@
+package event
+
+import (
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+type Kind string
+
+// kinds of events published during a run
+const (
+	RunStarted   Kind = "run_started"
+	TaskPlanned  Kind = "task_planned"
+	TaskStarted  Kind = "task_started"
+	Output       Kind = "output"
+	TaskFinished Kind = "task_finished"
+	// TaskFailed has the diagnostics of a task or data that failed; after all its attempts
+	TaskFailed Kind = "task_failed"
+	// Log is any other message about a task; ex: restored from cache
+	Log         Kind = "log"
+	Diagnostics Kind = "diagnostics"
+	// Span is a phase in the life of a task that took some time; starting at Time
+	Span        Kind = "span"
+	RunFinished Kind = "run_finished"
+)
+
+// phases of a Span event
+const (
+	// Decode of a task or data block once all its dependencies are done
+	Decode = "decode"
+	// Wait for the dependencies of a task or data block
+	Wait = "wait"
+	// Queue until a job slot is available
+	Queue = "queue"
+	// Execute a task or data instance; once for every job slot held by it, ex: between retries
+	Execute = "execute"
+)
+
+// streams of an Output event
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// Event is something that happened during a run. Only the fields relevant to
+// its Kind are set
+type Event struct {
+	Kind Kind
+	Time time.Time
+	// Task is the address of the task or data; for run events the task requested by the user
+	Task string
+	// Run is false if a planned task is skipped
+	Run bool
+	// Reason why a task runs or is skipped
+	Reason string
+	// Mode is the output mode of a started task
+	Mode string
+	// Stream of an output line
+	Stream string
+	// Text of an output line or a log message
+	Text     string
+	ExitCode int64
+	Duration time.Duration
+	// Success of a finished run
+	Success bool
+	// Phase of a span; Slot is the job slot of an Execute span
+	Phase string
+	Slot  int
+	// Dependencies listed in the depends_on of a decoded block
+	Dependencies []string
+	// Diagnostics of a run; errors make the run fail
+	Diagnostics hcl.Diagnostics
+}
@@ -0,0 +1,119 @@
+package event
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// JSON renders every event as a single line of json
+type JSON struct {
+	encoder *json.Encoder
+}
+
+func NewJSON(out io.Writer) *JSON {
+	return &JSON{encoder: json.NewEncoder(out)}
+}
+
+type jsonEvent struct {
+	Event        Kind             `json:"event"`
+	Time         time.Time        `json:"time"`
+	Task         string           `json:"task,omitempty"`
+	Run          *bool            `json:"run,omitempty"`
+	Reason       string           `json:"reason,omitempty"`
+	Stream       string           `json:"stream,omitempty"`
+	Text         string           `json:"text,omitempty"`
+	ExitCode     *int64           `json:"exit_code,omitempty"`
+	DurationMS   *float64         `json:"duration_ms,omitempty"`
+	Success      *bool            `json:"success,omitempty"`
+	Phase        string           `json:"phase,omitempty"`
+	Slot         *int             `json:"slot,omitempty"`
+	Dependencies []string         `json:"dependencies,omitempty"`
+	Diagnostics  []jsonDiagnostic `json:"diagnostics,omitempty"`
+}
+
+type jsonDiagnostic struct {
+	Severity string     `json:"severity"`
+	Summary  string     `json:"summary"`
+	Detail   string     `json:"detail,omitempty"`
+	Range    *jsonRange `json:"range,omitempty"`
+}
+
+type jsonRange struct {
+	Filename string  `json:"filename"`
+	Start    jsonPos `json:"start"`
+	End      jsonPos `json:"end"`
+}
+
+type jsonPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (renderer *JSON) Handle(event Event) {
+	result := jsonEvent{
+		Event:  event.Kind,
+		Time:   event.Time,
+		Task:   event.Task,
+		Reason: event.Reason,
+		Stream: event.Stream,
+		Text:   event.Text,
+	}
+
+	switch event.Kind {
+	case TaskPlanned:
+		result.Run = &event.Run
+	case TaskFinished:
+		result.ExitCode = &event.ExitCode
+		result.DurationMS = milliseconds(event.Duration)
+	case Diagnostics, TaskFailed:
+		for _, diag := range event.Diagnostics {
+			result.Diagnostics = append(result.Diagnostics, jsonDiagnostic{
+				Severity: severity(diag.Severity),
+				Summary:  diag.Summary,
+				Detail:   diag.Detail,
+				Range:    newRange(diag.Subject),
+			})
+		}
+	case Span:
+		result.Phase = event.Phase
+		result.DurationMS = milliseconds(event.Duration)
+		result.Dependencies = event.Dependencies
+		if event.Phase == Execute || event.Phase == Queue {
+			result.Slot = &event.Slot
+		}
+	case RunFinished:
+		result.Success = &event.Success
+		result.DurationMS = milliseconds(event.Duration)
+	}
+
+	// nothing useful can be done if stdout is gone
+	_ = renderer.encoder.Encode(result)
+}
+
+func milliseconds(duration time.Duration) *float64 {
+	ms := float64(duration) / float64(time.Millisecond)
+	return &ms
+}
+
+func severity(severity hcl.DiagnosticSeverity) string {
+	if severity == hcl.DiagError {
+		return "error"
+	}
+
+	return "warning"
+}
+
+func newRange(subject *hcl.Range) *jsonRange {
+	if subject == nil {
+		return nil
+	}
+
+	return &jsonRange{
+		Filename: subject.Filename,
+		Start:    jsonPos{Line: subject.Start.Line, Column: subject.Start.Column},
+		End:      jsonPos{Line: subject.End.Line, Column: subject.End.Column},
+	}
+}
@@ -0,0 +1,114 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+func TestJSONEvents(t *testing.T) {
+	subject := &hcl.Range{Filename: "main.hcl", Start: hcl.Pos{Line: 2, Column: 3}, End: hcl.Pos{Line: 2, Column: 10}}
+	diagnostics := hcl.Diagnostics{{Severity: hcl.DiagError, Summary: "build failed", Detail: "exit status 2", Subject: subject}}
+	tests := []struct {
+		event  Event
+		fields map[string]string
+	}{
+		{
+			event:  Event{Kind: RunStarted, Task: "all"},
+			fields: map[string]string{"task": "all"},
+		},
+		{
+			event:  Event{Kind: TaskPlanned, Task: "build", Run: false, Reason: "up to date"},
+			fields: map[string]string{"task": "build", "run": "false", "reason": "up to date"},
+		},
+		{
+			event:  Event{Kind: TaskStarted, Task: "build", Mode: Grouped},
+			fields: map[string]string{"task": "build"},
+		},
+		{
+			event:  Event{Kind: Output, Task: "build", Stream: Stderr, Text: "warning: unused"},
+			fields: map[string]string{"task": "build", "stream": "stderr", "text": "warning: unused"},
+		},
+		{
+			event:  Event{Kind: TaskFinished, Task: "build", ExitCode: 2, Duration: 1500 * time.Microsecond},
+			fields: map[string]string{"task": "build", "exit_code": "2", "duration_ms": "1.5"},
+		},
+		{
+			event: Event{Kind: TaskFailed, Task: "build", Diagnostics: diagnostics},
+			fields: map[string]string{
+				"task":        "build",
+				"diagnostics": "[map[detail:exit status 2 range:map[end:map[column:10 line:2] filename:main.hcl start:map[column:3 line:2]] severity:error summary:build failed]]",
+			},
+		},
+		{
+			event:  Event{Kind: Log, Task: "build", Text: "restored from cache"},
+			fields: map[string]string{"task": "build", "text": "restored from cache"},
+		},
+		{
+			event:  Event{Kind: Diagnostics, Task: "all", Diagnostics: hcl.Diagnostics{{Severity: hcl.DiagWarning, Summary: "1 failed"}}},
+			fields: map[string]string{"task": "all", "diagnostics": "[map[severity:warning summary:1 failed]]"},
+		},
+		{
+			event:  Event{Kind: Span, Task: "build", Phase: Execute, Slot: 3, Duration: 2 * time.Millisecond},
+			fields: map[string]string{"task": "build", "phase": "execute", "slot": "3", "duration_ms": "2"},
+		},
+		{
+			event:  Event{Kind: Span, Task: "build", Phase: Decode, Dependencies: []string{"gen[0]"}},
+			fields: map[string]string{"task": "build", "phase": "decode", "duration_ms": "0", "dependencies": "[gen[0]]"},
+		},
+		{
+			event:  Event{Kind: RunFinished, Task: "all", Success: true, Duration: time.Second},
+			fields: map[string]string{"task": "all", "success": "true", "duration_ms": "1000"},
+		},
+	}
+
+	// arrange
+	var out bytes.Buffer
+	bus := NewBus(NewJSON(&out))
+
+	// act
+	for _, test := range tests {
+		bus.Publish(test.event)
+	}
+
+	// assert
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(tests) {
+		t.Fatalf("expected %d lines but got %d:\n%s", len(tests), len(lines), out.String())
+	}
+
+	for index, test := range tests {
+		t.Run(fmt.Sprintf("%s %s", test.event.Kind, test.event.Phase), func(t *testing.T) {
+			var got map[string]interface{}
+			err := json.Unmarshal([]byte(lines[index]), &got)
+			if err != nil {
+				t.Fatalf("expected a json object but got %s: %v", lines[index], err)
+			}
+
+			if got["event"] != string(test.event.Kind) {
+				t.Errorf(`expected event "%s" but got "%v"`, test.event.Kind, got["event"])
+			}
+
+			timestamp, ok := got["time"].(string)
+			if _, err := time.Parse(time.RFC3339Nano, timestamp); !ok || err != nil {
+				t.Errorf("expected a timestamp but got %v", got["time"])
+			}
+
+			// every field other than those expected is omitted
+			if len(got) != len(test.fields)+2 {
+				t.Errorf("expected the fields %v but got %s", test.fields, lines[index])
+			}
+
+			for name, want := range test.fields {
+				if fmt.Sprint(got[name]) != want {
+					t.Errorf(`expected %s "%s" but got "%v"`, name, want, got[name])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package event
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"bake/internal/paths"
+)
+
+// JUnit records every planned task and data as a testcase of a JUnit XML report
+type JUnit struct {
+	name     string
+	start    time.Time
+	duration time.Duration
+	order    []string
+	cases    map[string]*testcase
+}
+
+type testcase struct {
+	name     string
+	skipped  string
+	started  time.Time
+	finished time.Time
+	exitCode *int64
+	stdout   strings.Builder
+	stderr   strings.Builder
+	failures []string
+	detail   []string
+}
+
+func NewJUnit() *JUnit {
+	return &JUnit{cases: map[string]*testcase{}}
+}
+
+func (junit *JUnit) Handle(event Event) {
+	switch event.Kind {
+	case RunStarted:
+		junit.name = event.Task
+		junit.start = event.Time
+	case RunFinished:
+		junit.duration = event.Duration
+	case TaskPlanned:
+		test := junit.testcase(event.Task)
+		if !event.Run {
+			test.skipped = event.Reason
+		}
+	case TaskStarted:
+		test := junit.testcase(event.Task)
+		if test.started.IsZero() {
+			test.started = event.Time
+		}
+	case Output:
+		test := junit.testcase(event.Task)
+		if event.Stream == Stderr {
+			test.stderr.WriteString(event.Text + "\n")
+			return
+		}
+
+		test.stdout.WriteString(event.Text + "\n")
+	case TaskFinished:
+		// the last attempt wins
+		test := junit.testcase(event.Task)
+		test.finished = event.Time
+		exitCode := event.ExitCode
+		test.exitCode = &exitCode
+	case TaskFailed:
+		test := junit.testcase(event.Task)
+		for _, diag := range event.Diagnostics {
+			test.failures = append(test.failures, diag.Summary)
+			test.detail = append(test.detail, diag.Detail)
+		}
+	}
+}
+
+func (junit *JUnit) testcase(name string) *testcase {
+	test, ok := junit.cases[name]
+	if !ok {
+		test = &testcase{name: name}
+		junit.cases[name] = test
+		junit.order = append(junit.order, name)
+	}
+
+	return test
+}
+
+type xmlSuites struct {
+	XMLName  xml.Name   `xml:"testsuites"`
+	Name     string     `xml:"name,attr"`
+	Tests    int        `xml:"tests,attr"`
+	Failures int        `xml:"failures,attr"`
+	Skipped  int        `xml:"skipped,attr"`
+	Time     float64    `xml:"time,attr"`
+	Suites   []xmlSuite `xml:"testsuite"`
+}
+
+type xmlSuite struct {
+	Name      string    `xml:"name,attr"`
+	Tests     int       `xml:"tests,attr"`
+	Failures  int       `xml:"failures,attr"`
+	Skipped   int       `xml:"skipped,attr"`
+	Time      float64   `xml:"time,attr"`
+	Timestamp string    `xml:"timestamp,attr"`
+	Cases     []xmlCase `xml:"testcase"`
+}
+
+type xmlCase struct {
+	Name       string         `xml:"name,attr"`
+	Classname  string         `xml:"classname,attr"`
+	Time       float64        `xml:"time,attr"`
+	Properties *xmlProperties `xml:"properties,omitempty"`
+	Failure    *xmlMessage    `xml:"failure,omitempty"`
+	Skipped    *xmlMessage    `xml:"skipped,omitempty"`
+	Stdout     string         `xml:"system-out,omitempty"`
+	Stderr     string         `xml:"system-err,omitempty"`
+}
+
+type xmlProperties struct {
+	Properties []xmlProperty `xml:"property"`
+}
+
+type xmlProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type xmlMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteFile with the report of the run
+func (junit *JUnit) WriteFile(filename string) error {
+	suite := xmlSuite{
+		Name:      junit.name,
+		Time:      junit.duration.Seconds(),
+		Timestamp: junit.start.Format("2006-01-02T15:04:05"),
+	}
+
+	for _, name := range junit.order {
+		test := junit.cases[name]
+		result := xmlCase{
+			Name:      name,
+			Classname: paths.InstanceOf(name),
+			Stdout:    test.stdout.String(),
+			Stderr:    test.stderr.String(),
+		}
+
+		if !test.started.IsZero() && !test.finished.IsZero() {
+			result.Time = test.finished.Sub(test.started).Seconds()
+		}
+
+		if test.exitCode != nil {
+			result.Properties = &xmlProperties{Properties: []xmlProperty{{
+				Name:  "exit_code",
+				Value: fmt.Sprint(*test.exitCode),
+			}}}
+		}
+
+		switch {
+		case len(test.failures) > 0:
+			suite.Failures++
+			result.Failure = &xmlMessage{
+				Message: strings.Join(test.failures, "; "),
+				Text:    strings.Join(test.detail, "\n\n"),
+			}
+		case test.skipped != "":
+			suite.Skipped++
+			result.Skipped = &xmlMessage{Message: test.skipped}
+		}
+
+		suite.Tests++
+		suite.Cases = append(suite.Cases, result)
+	}
+
+	report := xmlSuites{
+		Name:     "bake",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []xmlSuite{suite},
+	}
+
+	content, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, append([]byte(xml.Header), append(content, '\n')...), 0644)
+}
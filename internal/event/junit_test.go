@@ -0,0 +1,54 @@
+package event
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+func TestJUnitReport(t *testing.T) {
+	// arrange
+	junit := NewJUnit()
+	bus := NewBus(junit)
+	bus.Publish(Event{Kind: RunStarted, Task: "all"})
+	compile := bus.Logger(`compile["arm64"]`)
+	compile.Planned(true, "baking")
+	compile.Started(Interleaved)
+	writer := compile.Writer(Stdout)
+	_, _ = writer.Write([]byte("building\n"))
+	compile.Finished(2, 0)
+	bus.Publish(Event{Kind: TaskFailed, Task: `compile["arm64"]`, Diagnostics: hcl.Diagnostics{{
+		Severity: hcl.DiagError,
+		Summary:  "compile failed",
+	}}})
+	bus.Logger("test").Planned(false, "up to date")
+	bus.Publish(Event{Kind: RunFinished, Task: "all"})
+
+	// act
+	filename := filepath.Join(t.TempDir(), "report.xml")
+	err := junit.WriteFile(filename)
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`tests="2" failures="1" skipped="1"`,
+		`<testcase name="compile[&#34;arm64&#34;]" classname="compile"`,
+		`<failure message="compile failed">`,
+		`<system-out>building&#xA;</system-out>`,
+		`<skipped message="up to date">`,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expected %s in report:\n%s", expected, content)
+		}
+	}
+}
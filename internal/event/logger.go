@@ -0,0 +1,85 @@
+package event
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Logger publishes the events of a single task to a bus
+type Logger struct {
+	bus  *Bus
+	task string
+}
+
+func (log *Logger) Println(text string) {
+	log.bus.Publish(Event{Kind: Log, Task: log.task, Text: text})
+}
+
+func (log *Logger) Printf(format string, args ...any) {
+	log.Println(fmt.Sprintf(format, args...))
+}
+
+// Planned reports whether the task will run and why
+func (log *Logger) Planned(run bool, reason string) {
+	log.bus.Publish(Event{Kind: TaskPlanned, Task: log.task, Run: run, Reason: reason})
+}
+
+// Started reports that the command of the task started; once per attempt
+func (log *Logger) Started(mode string) {
+	log.bus.Publish(Event{Kind: TaskStarted, Task: log.task, Mode: mode})
+}
+
+func (log *Logger) Finished(exitCode int64, duration time.Duration) {
+	log.bus.Publish(Event{Kind: TaskFinished, Task: log.task, ExitCode: exitCode, Duration: duration})
+}
+
+// Span reports that the task was in phase since start until now
+func (log *Logger) Span(phase string, start time.Time, slot int) {
+	log.SpanFor(phase, start, time.Since(start), slot)
+}
+
+// SpanFor reports that the task was in phase since start for duration
+func (log *Logger) SpanFor(phase string, start time.Time, duration time.Duration, slot int) {
+	log.bus.Publish(Event{Kind: Span, Task: log.task, Time: start, Duration: duration, Phase: phase, Slot: slot})
+}
+
+// Writer publishes everything written to it as Output events; one per line. It
+// must be flushed once the command is done so that a last line without a trailing
+// newline is not lost
+func (log *Logger) Writer(stream string) *LineWriter {
+	return &LineWriter{log: log, stream: stream}
+}
+
+type LineWriter struct {
+	log     *Logger
+	stream  string
+	pending []byte
+}
+
+func (writer *LineWriter) Write(p []byte) (int, error) {
+	writer.pending = append(writer.pending, p...)
+	for {
+		index := bytes.IndexByte(writer.pending, '\n')
+		if index < 0 {
+			return len(p), nil
+		}
+
+		writer.publish(strings.TrimSuffix(string(writer.pending[:index]), "\r"))
+		writer.pending = writer.pending[index+1:]
+	}
+}
+
+func (writer *LineWriter) Flush() {
+	if len(writer.pending) == 0 {
+		return
+	}
+
+	writer.publish(string(writer.pending))
+	writer.pending = nil
+}
+
+func (writer *LineWriter) publish(line string) {
+	writer.log.bus.Publish(Event{Kind: Output, Task: writer.log.task, Stream: writer.stream, Text: line})
+}
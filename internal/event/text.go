@@ -0,0 +1,93 @@
+package event
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/mitchellh/colorstring"
+)
+
+// output modes of the commands run by tasks
+const (
+	// Interleaved prints every line as soon as it is written; prefixed by its task
+	Interleaved = "interleaved"
+	// Grouped prints all the lines of a task together once it is done
+	Grouped = "grouped"
+	// Quiet only prints the lines of a task if it failed
+	Quiet = "quiet"
+)
+
+var Modes = []string{Interleaved, Grouped, Quiet}
+
+func ValidateMode(mode string) error {
+	for _, known := range Modes {
+		if mode == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf(`unknown output "%s"; expected one of: %s`, mode, strings.Join(Modes, ", "))
+}
+
+// Text renders events for humans; every line is prefixed by the task that produced it
+type Text struct {
+	out         io.Writer
+	diagnostics hcl.DiagnosticWriter
+	// output modes and lines kept until each task is done
+	modes   map[string]string
+	lines   map[string][]string
+	pending hcl.Diagnostics
+}
+
+func NewText(out io.Writer, diagnostics hcl.DiagnosticWriter) *Text {
+	return &Text{
+		out:         out,
+		diagnostics: diagnostics,
+		modes:       map[string]string{},
+		lines:       map[string][]string{},
+	}
+}
+
+func (text *Text) Handle(event Event) {
+	switch event.Kind {
+	case TaskPlanned:
+		text.println(event.Task, event.Reason)
+	case TaskStarted:
+		text.modes[event.Task] = event.Mode
+	case Output:
+		if text.modes[event.Task] == Interleaved {
+			text.println(event.Task, event.Text)
+			return
+		}
+
+		text.lines[event.Task] = append(text.lines[event.Task], event.Text)
+	case TaskFinished:
+		mode := text.modes[event.Task]
+		if mode == Grouped || (mode == Quiet && event.ExitCode != 0) {
+			for _, line := range text.lines[event.Task] {
+				text.println(event.Task, line)
+			}
+		}
+
+		delete(text.lines, event.Task)
+		text.println(event.Task, "done in "+event.Duration.String())
+	case Log:
+		text.println(event.Task, event.Text)
+	case Diagnostics:
+		// printed at the end so that they are not lost among the output of other tasks
+		text.pending = append(text.pending, event.Diagnostics...)
+	case RunFinished:
+		fmt.Fprintf(text.out, "\ndone in %s\n", event.Duration.String())
+		if len(text.pending) > 0 {
+			_ = text.diagnostics.WriteDiagnostics(text.pending)
+			text.pending = nil
+		}
+	}
+}
+
+func (text *Text) println(task, line string) {
+	prefix := colorstring.Color("[bold]" + task)
+	fmt.Fprintln(text.out, prefix+": "+line)
+}
@@ -0,0 +1,43 @@
+package event
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/colorstring"
+)
+
+func TestTextModes(t *testing.T) {
+	// arrange
+	var out bytes.Buffer
+	bus := NewBus(NewText(&out, nil))
+	run := func(task, mode string, exitCode int64) {
+		log := bus.Logger(task)
+		log.Started(mode)
+		writer := log.Writer(Stdout)
+		_, _ = writer.Write([]byte("first\nsec"))
+		_, _ = writer.Write([]byte("ond\nlast"))
+		writer.Flush()
+		log.Finished(exitCode, 0)
+	}
+
+	// act
+	run("interleaved", Interleaved, 0)
+	run("grouped", Grouped, 0)
+	run("quiet", Quiet, 0)
+	run("failed", Quiet, 1)
+	// assert
+	for _, task := range []string{"interleaved", "grouped", "failed"} {
+		for _, line := range []string{"first", "second", "last"} {
+			expected := colorstring.Color("[bold]"+task) + ": " + line + "\n"
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("expected %q in output:\n%s", expected, out.String())
+			}
+		}
+	}
+
+	if strings.Contains(out.String(), colorstring.Color("[bold]quiet")+": first") {
+		t.Errorf("expected no output from a quiet task that succeeded:\n%s", out.String())
+	}
+}
@@ -0,0 +1,197 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"bake/internal/paths"
+)
+
+// Trace records the spans of a run in the Chrome Trace Event Format; viewable with
+// chrome://tracing or https://ui.perfetto.dev. The coordinator has its own track while
+// every job slot gets another one. Queued instances are shown as async spans since many
+// of them wait at the same time
+type Trace struct {
+	start        time.Time
+	spans        []Event
+	dependencies map[string][]string
+}
+
+func NewTrace() *Trace {
+	return &Trace{dependencies: map[string][]string{}}
+}
+
+func (trace *Trace) Handle(event Event) {
+	switch event.Kind {
+	case RunStarted:
+		trace.start = event.Time
+	case Span:
+		trace.spans = append(trace.spans, event)
+		if event.Phase == Decode && len(event.Dependencies) > 0 {
+			trace.dependencies[event.Task] = event.Dependencies
+		}
+	}
+}
+
+type traceEvent struct {
+	Name      string            `json:"name"`
+	Category  string            `json:"cat,omitempty"`
+	Phase     string            `json:"ph"`
+	Timestamp float64           `json:"ts"`
+	Duration  *float64          `json:"dur,omitempty"`
+	PID       int               `json:"pid"`
+	TID       int               `json:"tid"`
+	ID        *int              `json:"id,omitempty"`
+	Binding   string            `json:"bp,omitempty"`
+	Args      map[string]string `json:"args,omitempty"`
+}
+
+// WriteFile with all the spans recorded so far
+func (trace *Trace) WriteFile(filename string) error {
+	events := []traceEvent{{
+		Name:  "process_name",
+		Phase: "M",
+		Args:  map[string]string{"name": "bake"},
+	}, {
+		Name:  "thread_name",
+		Phase: "M",
+		Args:  map[string]string{"name": "coordinator"},
+	}}
+
+	slots := map[int]bool{}
+	// instances might execute more than once, ex: on another slot after waiting to retry
+	executed := make([]string, 0)
+	first, last := map[string]Event{}, map[string]Event{}
+	id := 0
+	for _, span := range trace.spans {
+		switch span.Phase {
+		case Decode, Wait:
+			events = append(events, trace.complete(span, 0))
+		case Queue:
+			id++
+			spanID := id
+			events = append(events, traceEvent{
+				Name:      span.Task,
+				Category:  Queue,
+				Phase:     "b",
+				Timestamp: trace.microseconds(span.Time),
+				PID:       0,
+				ID:        &spanID,
+			}, traceEvent{
+				Name:      span.Task,
+				Category:  Queue,
+				Phase:     "e",
+				Timestamp: trace.microseconds(span.Time.Add(span.Duration)),
+				PID:       0,
+				ID:        &spanID,
+			})
+		case Execute:
+			slots[span.Slot] = true
+			if _, ok := first[span.Task]; !ok {
+				first[span.Task] = span
+				executed = append(executed, span.Task)
+			}
+
+			last[span.Task] = span
+			events = append(events, trace.complete(span, span.Slot+1))
+		}
+	}
+
+	for _, slot := range sortedSlots(slots) {
+		events = append(events, traceEvent{
+			Name:  "thread_name",
+			Phase: "M",
+			TID:   slot + 1,
+			Args:  map[string]string{"name": fmt.Sprintf("slot %d", slot+1)},
+		})
+	}
+
+	// depends_on edges from the end of the dependency to the start of the dependent
+	for _, dependent := range executed {
+		for _, dependency := range executed {
+			if !trace.dependsOn(dependent, dependency) {
+				continue
+			}
+
+			id++
+			flowID := id
+			end, start := last[dependency], first[dependent]
+			events = append(events, traceEvent{
+				Name:      "depends_on",
+				Category:  "depends_on",
+				Phase:     "s",
+				Binding:   "e",
+				Timestamp: trace.microseconds(end.Time.Add(end.Duration)),
+				PID:       0,
+				TID:       end.Slot + 1,
+				ID:        &flowID,
+			}, traceEvent{
+				Name:      "depends_on",
+				Category:  "depends_on",
+				Phase:     "f",
+				Binding:   "e",
+				Timestamp: trace.microseconds(start.Time),
+				PID:       0,
+				TID:       start.Slot + 1,
+				ID:        &flowID,
+			})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Phase == "M" && events[j].Phase != "M"
+	})
+
+	content, err := json.Marshal(map[string]interface{}{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, content, 0644)
+}
+
+func (trace *Trace) complete(span Event, tid int) traceEvent {
+	duration := float64(span.Duration) / float64(time.Microsecond)
+	return traceEvent{
+		Name:      span.Task,
+		Category:  span.Phase,
+		Phase:     "X",
+		Timestamp: trace.microseconds(span.Time),
+		Duration:  &duration,
+		PID:       0,
+		TID:       tid,
+		Args:      map[string]string{"phase": span.Phase},
+	}
+}
+
+func (trace *Trace) microseconds(t time.Time) float64 {
+	return float64(t.Sub(trace.start)) / float64(time.Microsecond)
+}
+
+func sortedSlots(slots map[int]bool) []int {
+	result := make([]int, 0, len(slots))
+	for slot := range slots {
+		result = append(result, slot)
+	}
+
+	sort.Ints(result)
+	return result
+}
+
+// dependsOn checks if the dependent instance lists the dependency instance in its
+// depends_on; all instances of a for_each block share the same dependencies
+func (trace *Trace) dependsOn(dependent, dependency string) bool {
+	for _, name := range trace.dependencies[paths.InstanceOf(dependent)] {
+		if dependency == name || paths.InstanceOf(dependency) == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,118 @@
+package event
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTraceFlows(t *testing.T) {
+	// arrange
+	trace := NewTrace()
+	bus := NewBus(trace)
+	start := time.Now()
+	bus.Publish(Event{Kind: RunStarted, Task: "pack", Time: start})
+	bus.Publish(Event{Kind: Span, Task: "pack", Phase: Decode, Time: start, Dependencies: []string{"compile"}})
+	bus.Publish(Event{Kind: Span, Task: `compile["arm64"]`, Phase: Execute, Time: start, Duration: time.Second, Slot: 0})
+	bus.Publish(Event{Kind: Span, Task: `compile["amd64"]`, Phase: Execute, Time: start, Duration: time.Second, Slot: 1})
+	bus.Publish(Event{Kind: Span, Task: "pack", Phase: Execute, Time: start.Add(time.Second), Duration: time.Second, Slot: 0})
+
+	// act
+	filename := filepath.Join(t.TempDir(), "trace.json")
+	err := trace.WriteFile(filename)
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	err = json.Unmarshal(content, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	phases := map[string]int{}
+	for _, event := range result.TraceEvents {
+		phases[event.Phase]++
+	}
+
+	// one flow from each compile instance to pack
+	if phases["s"] != 2 || phases["f"] != 2 {
+		t.Errorf("expected 2 flows but got %v", phases)
+	}
+
+	// decode and 3 executions
+	if phases["X"] != 4 {
+		t.Errorf("expected 4 complete events but got %v", phases)
+	}
+
+	for _, event := range result.TraceEvents {
+		// the dependencies end when pack starts
+		if (event.Phase == "s" || event.Phase == "f") && event.Timestamp != float64(time.Second/time.Microsecond) {
+			t.Errorf("expected the flow %s at 1s but got %fµs", event.Phase, event.Timestamp)
+		}
+	}
+}
+
+func TestTraceFlowsAfterRetry(t *testing.T) {
+	// arrange
+	trace := NewTrace()
+	bus := NewBus(trace)
+	start := time.Now()
+	bus.Publish(Event{Kind: RunStarted, Task: "pack", Time: start})
+	bus.Publish(Event{Kind: Span, Task: "pack", Phase: Decode, Time: start, Dependencies: []string{"upload"}})
+	// upload failed on the first slot and succeeded on the second one after waiting
+	bus.Publish(Event{Kind: Span, Task: "upload", Phase: Execute, Time: start, Duration: time.Second, Slot: 0})
+	bus.Publish(Event{Kind: Span, Task: "upload", Phase: Execute, Time: start.Add(2 * time.Second), Duration: time.Second, Slot: 1})
+	bus.Publish(Event{Kind: Span, Task: "pack", Phase: Execute, Time: start.Add(3 * time.Second), Duration: time.Second, Slot: 0})
+
+	// act
+	filename := filepath.Join(t.TempDir(), "trace.json")
+	err := trace.WriteFile(filename)
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	err = json.Unmarshal(content, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flows := map[string]traceEvent{}
+	for _, event := range result.TraceEvents {
+		if event.Phase == "s" || event.Phase == "f" {
+			flows[event.Phase] = event
+		}
+	}
+
+	if len(flows) != 2 {
+		t.Fatalf("expected a single flow but got %v", flows)
+	}
+
+	// from the end of the last execution of upload
+	if flows["s"].TID != 2 || flows["s"].Timestamp != float64(3*time.Second/time.Microsecond) {
+		t.Errorf("expected the flow to start on slot 2 at 3s but got %+v", flows["s"])
+	}
+
+	if flows["f"].TID != 1 || flows["f"].Timestamp != float64(3*time.Second/time.Microsecond) {
+		t.Errorf("expected the flow to finish on slot 1 at 3s but got %+v", flows["f"])
+	}
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"bake/internal/lang/config"
+	"bake/internal/module"
+	"bake/internal/paths"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// Explain why the task would run. Contrary to a dry run, every staleness criteria is
+// evaluated and the chain of dependencies that leads to the rebuild is printed
+func Explain(taskName string, state *config.State, parser *hclparse.Parser, out io.Writer) hcl.Diagnostics {
+	addrs, diags := readRecipes(state, parser)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	task, diags := getTask(taskName, addrs)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	state.Flags.Dry = true
+	coordinator := module.NewCoordinator()
+	actions, diags := coordinator.Do(state, task, addrs)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	explanations := map[string][]config.Explanation{}
+	for _, action := range actions {
+		if explainer, ok := action.(config.Explainer); ok {
+			explanations[config.AddressToString(action)] = explainer.Explain()
+		}
+	}
+
+	printer := explanationPrinter{out: out, explanations: explanations, visited: map[string]bool{}}
+	printer.print(config.AddressToString(task), 0)
+	return nil
+}
+
+type explanationPrinter struct {
+	out io.Writer
+	// explanations of the instances of each action; by the name of the action
+	explanations map[string][]config.Explanation
+	// dependencies shared by several tasks are only explained once
+	visited map[string]bool
+}
+
+// print the explanation of every instance referred by name, ex: gen[0] only
+// refers to the first instance of gen while gen refers to all of them
+func (printer explanationPrinter) print(name string, depth int) {
+	indent := strings.Repeat("    ", depth)
+	action := paths.InstanceOf(name)
+	for _, explanation := range printer.explanations[action] {
+		if name != action && explanation.Path != name {
+			continue
+		}
+
+		if printer.visited[explanation.Path] {
+			fmt.Fprintf(printer.out, "%s%s: explained above\n", indent, explanation.Path)
+			continue
+		}
+
+		printer.visited[explanation.Path] = true
+		if len(explanation.Stale) == 0 {
+			fmt.Fprintf(printer.out, "%s%s: up to date; %s\n", indent, explanation.Path, strings.TrimSuffix(explanation.Skip, " ... skipping"))
+			continue
+		}
+
+		fmt.Fprintf(printer.out, "%s%s: would run because\n", indent, explanation.Path)
+		for _, stale := range explanation.Stale {
+			location := ""
+			if stale.Subject != nil && stale.Subject.Filename != "" {
+				location = fmt.Sprintf(" (%s)", stale.Subject.String())
+			}
+
+			fmt.Fprintf(printer.out, "%s  - %s%s\n", indent, stale.Reason, location)
+			for _, dependency := range stale.Dependencies {
+				printer.print(dependency, depth+1)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"bake/internal/lang/config"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+func TestExplanationPrinter(t *testing.T) {
+	explanations := map[string][]config.Explanation{
+		"tool": {{Path: "tool", Skip: `"tool" is up to date ... skipping`}},
+		"gen": {
+			{Path: "gen[0]", Stale: []config.Staleness{{Reason: `"command" has changed`}}},
+			{Path: "gen[1]", Skip: `"gen1.txt" is up to date ... skipping`},
+		},
+		"lib": {
+			{Path: `lib["darwin"]`, Skip: `"darwin.a" is up to date ... skipping`},
+			{Path: `lib["linux"]`, Stale: []config.Staleness{{Reason: `"linux.a" doesn't exists`}}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		dependency string
+		want       []string
+	}{
+		{
+			name:       "plain",
+			dependency: "tool",
+			want:       []string{`    tool: up to date; "tool" is up to date`},
+		},
+		{
+			name:       "every instance",
+			dependency: "gen",
+			want: []string{
+				"    gen[0]: would run because",
+				`      - "command" has changed`,
+				`    gen[1]: up to date; "gen1.txt" is up to date`,
+			},
+		},
+		{
+			name:       "count",
+			dependency: "gen[0]",
+			want: []string{
+				"    gen[0]: would run because",
+				`      - "command" has changed`,
+			},
+		},
+		{
+			name:       "for_each",
+			dependency: `lib["linux"]`,
+			want: []string{
+				`    lib["linux"]: would run because`,
+				`      - "linux.a" doesn't exists`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			var out bytes.Buffer
+			printer := explanationPrinter{out: &out, explanations: map[string][]config.Explanation{
+				"build": {{Path: "build", Stale: []config.Staleness{{
+					Reason:       `dependency "` + test.dependency + `" has changed`,
+					Dependencies: []string{test.dependency},
+				}}}},
+			}, visited: map[string]bool{}}
+			for name, explanation := range explanations {
+				printer.explanations[name] = explanation
+			}
+
+			// act
+			printer.print("build", 0)
+
+			// assert
+			want := append([]string{
+				"build: would run because",
+				`  - dependency "` + test.dependency + `" has changed`,
+			}, test.want...)
+			if out.String() != strings.Join(want, "\n")+"\n" {
+				t.Errorf("expected:\n%s\nbut got:\n%s", strings.Join(want, "\n"), out.String())
+			}
+		})
+	}
+}
+
+func TestExplainVisited(t *testing.T) {
+	// arrange
+	var out bytes.Buffer
+	printer := explanationPrinter{out: &out, explanations: map[string][]config.Explanation{
+		"all": {{Path: "all", Stale: []config.Staleness{
+			{Reason: `dependency "gen[0]" has changed`, Dependencies: []string{"gen[0]"}},
+			{Reason: `dependency "gen" has changed`, Dependencies: []string{"gen"}},
+		}}},
+		"gen": {
+			{Path: "gen[0]", Stale: []config.Staleness{{Reason: `"command" has changed`}}},
+			{Path: "gen[1]", Stale: []config.Staleness{{Reason: `"command" has changed`}}},
+		},
+	}, visited: map[string]bool{}}
+
+	// act
+	printer.print("all", 0)
+
+	// assert
+	want := strings.Join([]string{
+		"all: would run because",
+		`  - dependency "gen[0]" has changed`,
+		"    gen[0]: would run because",
+		`      - "command" has changed`,
+		`  - dependency "gen" has changed`,
+		"    gen[0]: explained above",
+		"    gen[1]: would run because",
+		`      - "command" has changed`,
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, out.String())
+	}
+}
+
+func TestExplain(t *testing.T) {
+	recipe := `
+task "gen" {
+  count   = 2
+  command = "echo ${count.index} > gen${count.index}.txt"
+  creates = ["gen${count.index}.txt"]
+}
+
+task "lib" {
+  for_each = { linux = "amd64", darwin = "arm64" }
+  command  = "echo ${each.value} > ${each.key}.a"
+  creates  = ["${each.key}.a"]
+}
+
+task "tool" {
+  command = "echo tool > tool"
+  creates = ["tool"]
+}
+
+task "build" {
+  command    = "true"
+  depends_on = [tool, gen[1], lib["darwin"]]
+}
+`
+	// arrange
+	chdir(t, t.TempDir())
+	write(t, map[string]string{"main.hcl": recipe})
+	state, err := config.NewState(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+
+	// act
+	diags := Explain("build", state, hclparse.NewParser(), &out)
+
+	// assert
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	for _, expected := range []string{
+		`  - dependency "tool", "gen[1]", "lib["darwin"]" has changed (main.hcl:21,3-45)`,
+		"    tool: would run because",
+		"    gen[1]: would run because",
+		`    lib["darwin"]: would run because`,
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+
+	for _, unexpected := range []string{"gen[0]:", `lib["linux"]:`} {
+		if strings.Contains(out.String(), unexpected) {
+			t.Errorf("expected no %q in:\n%s", unexpected, out.String())
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"bake/internal/event"
+	"bake/internal/graph"
+	"bake/internal/lang/config"
+	"bake/internal/module"
+	"bake/internal/module/topo"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// Graph of the dependencies of a task, or of all recipes if taskName is empty. Finding
+// the stale tasks or the instances of for_each blocks requires a dry run
+func Graph(taskName string, state *config.State, parser *hclparse.Parser, expand, stale bool) (*graph.Graph, hcl.Diagnostics) {
+	addrs, diags := readRecipes(state, parser)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	selected := addrs
+	var roots []config.RawAddress
+	if taskName != "" {
+		task, diags := getTask(taskName, addrs)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		selected, diags = topo.Dependencies(task, addrs)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		roots = []config.RawAddress{task}
+	}
+
+	result, diags := graph.New(selected, addrs)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	if !expand && !stale {
+		return result, nil
+	}
+
+	if roots == nil {
+		for _, name := range result.Roots() {
+			task, diags := getTask(name, addrs)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+
+			roots = append(roots, task)
+		}
+	}
+
+	runState, err := state.Fork(state.Context)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "error reading state",
+			Detail:   err.Error(),
+		}}
+	}
+
+	// the dry run is an implementation detail; its events are not part of the graph output
+	planned := &plannedTasks{instances: make([]string, 0), stale: map[string]bool{}}
+	runState.Events = event.NewBus()
+	runState.Events.Subscribe(planned)
+	runState.Flags.Dry = true
+	coordinator := module.NewCoordinator()
+	_, diags = coordinator.DoAll(runState, roots, addrs)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	if stale {
+		result.MarkStale(planned.stale)
+	}
+
+	if expand {
+		result.Expand(planned.instances)
+	}
+
+	return result, nil
+}
+
+// plannedTasks keeps track of the instances planned by a dry run
+type plannedTasks struct {
+	instances []string
+	stale     map[string]bool
+}
+
+func (planned *plannedTasks) Handle(e event.Event) {
+	if e.Kind != event.TaskPlanned {
+		return
+	}
+
+	planned.instances = append(planned.instances, e.Task)
+	if e.Run {
+		planned.stale[e.Task] = true
+	}
+}
@@ -0,0 +1,186 @@
+package graph
+
+import (
+	"sort"
+
+	"bake/internal/lang/config"
+	"bake/internal/lang/schema"
+	"bake/internal/module/topo"
+	"bake/internal/paths"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// kinds of nodes
+const (
+	Task  = "task"
+	Data  = "data"
+	Local = "local"
+)
+
+type Node struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Stale bool   `json:"stale"`
+}
+
+// Edge from a node to one of its dependencies. Explicit edges come from depends_on
+// while implicit ones from references in any other expression
+type Edge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Explicit bool   `json:"explicit"`
+}
+
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// New graph of the selected addresses; references are resolved against all addresses
+func New(selected, addresses []config.RawAddress) (*Graph, hcl.Diagnostics) {
+	graph := &Graph{Nodes: make([]Node, 0), Edges: make([]Edge, 0)}
+	for _, address := range selected {
+		graph.Nodes = append(graph.Nodes, Node{
+			ID:   config.AddressToString(address),
+			Kind: kind(address),
+		})
+
+		references, diags := address.Dependencies()
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		dependencies, diags := topo.Resolve(references, addresses)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		explicit := map[string]bool{}
+		if block, ok := address.(config.ExplicitDependencies); ok {
+			traversals, diags := block.DependsOn()
+			if diags.HasErrors() {
+				return nil, diags
+			}
+
+			dependsOn, diags := topo.Resolve(traversals, addresses)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+
+			for _, dependency := range dependsOn {
+				explicit[config.AddressToString(dependency)] = true
+			}
+		}
+
+		for _, dependency := range dependencies {
+			to := config.AddressToString(dependency)
+			graph.Edges = append(graph.Edges, Edge{
+				From:     config.AddressToString(address),
+				To:       to,
+				Explicit: explicit[to],
+			})
+		}
+	}
+
+	graph.sort()
+	return graph, nil
+}
+
+// Roots are the tasks that no other node depends on
+func (graph *Graph) Roots() []string {
+	dependencies := map[string]bool{}
+	for _, edge := range graph.Edges {
+		dependencies[edge.To] = true
+	}
+
+	roots := make([]string, 0)
+	for _, node := range graph.Nodes {
+		if node.Kind == Task && !dependencies[node.ID] {
+			roots = append(roots, node.ID)
+		}
+	}
+
+	return roots
+}
+
+// MarkStale tasks whose name or any of its instances is part of stale
+func (graph *Graph) MarkStale(stale map[string]bool) {
+	for index, node := range graph.Nodes {
+		if node.Kind != Task {
+			continue
+		}
+
+		for name := range stale {
+			if name == node.ID || paths.InstanceOf(name) == node.ID {
+				graph.Nodes[index].Stale = true
+			}
+		}
+	}
+}
+
+// Expand the nodes with for_each instances into a node per instance. Every instance
+// keeps the edges of its node
+func (graph *Graph) Expand(instances []string) {
+	expansions := map[string][]string{}
+	for _, name := range instances {
+		node := paths.InstanceOf(name)
+		if node != name {
+			expansions[node] = append(expansions[node], name)
+		}
+	}
+
+	expand := func(id string) []string {
+		if names, ok := expansions[id]; ok {
+			return names
+		}
+
+		return []string{id}
+	}
+
+	nodes := make([]Node, 0)
+	for _, node := range graph.Nodes {
+		for _, name := range expand(node.ID) {
+			nodes = append(nodes, Node{ID: name, Kind: node.Kind, Stale: node.Stale})
+		}
+	}
+
+	edges := make([]Edge, 0)
+	for _, edge := range graph.Edges {
+		for _, from := range expand(edge.From) {
+			for _, to := range expand(edge.To) {
+				edges = append(edges, Edge{From: from, To: to, Explicit: edge.Explicit})
+			}
+		}
+	}
+
+	graph.Nodes = nodes
+	graph.Edges = edges
+	graph.sort()
+}
+
+func (graph *Graph) sort() {
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].ID < graph.Nodes[j].ID
+	})
+
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+}
+
+func kind(address config.RawAddress) string {
+	path := schema.WithoutModule(address.GetPath())
+	switch {
+	case path.HasPrefix(schema.DataPrefix):
+		return Data
+	case path.HasPrefix(schema.LocalPrefix):
+		return Local
+	default:
+		return Task
+	}
+}
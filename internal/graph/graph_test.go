@@ -0,0 +1,39 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	// arrange
+	graph := &Graph{
+		Nodes: []Node{{ID: "compile", Kind: Task}, {ID: "pack", Kind: Task}, {ID: "data.version", Kind: Data}},
+		Edges: []Edge{
+			{From: "pack", To: "compile", Explicit: true},
+			{From: "compile", To: "data.version"},
+		},
+	}
+
+	// act
+	graph.Expand([]string{`compile["arm64"]`, `compile["amd64"]`, "pack", "data.version"})
+	graph.MarkStale(map[string]bool{`compile["arm64"]`: true})
+	var out strings.Builder
+	err := graph.Render(&out, Dot)
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`"compile[\"arm64\"]" [shape=box, style=filled, fillcolor="#f4cccc"];`,
+		`"compile[\"amd64\"]" [shape=box];`,
+		`"pack" -> "compile[\"amd64\"]" [style=solid];`,
+		`"pack" -> "compile[\"arm64\"]" [style=solid];`,
+		`"compile[\"arm64\"]" -> "data.version" [style=dashed];`,
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %s in graph:\n%s", expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// output formats
+const (
+	Dot     = "dot"
+	Mermaid = "mermaid"
+	JSON    = "json"
+)
+
+var Formats = []string{Dot, Mermaid, JSON}
+
+// Render the graph in one of Formats
+func (graph *Graph) Render(w io.Writer, format string) error {
+	switch format {
+	case Dot:
+		return graph.dot(w)
+	case Mermaid:
+		return graph.mermaid(w)
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(graph)
+	default:
+		return fmt.Errorf(`unknown format "%s"; expected one of: %s`, format, strings.Join(Formats, ", "))
+	}
+}
+
+func (graph *Graph) dot(w io.Writer) error {
+	var out strings.Builder
+	out.WriteString("digraph bake {\n  rankdir=LR;\n")
+	shapes := map[string]string{Task: "box", Data: "cylinder", Local: "note"}
+	for _, node := range graph.Nodes {
+		attributes := fmt.Sprintf("shape=%s", shapes[node.Kind])
+		if node.Stale {
+			attributes += `, style=filled, fillcolor="#f4cccc"`
+		}
+
+		fmt.Fprintf(&out, "  %s [%s];\n", quote(node.ID), attributes)
+	}
+
+	for _, edge := range graph.Edges {
+		style := "dashed"
+		if edge.Explicit {
+			style = "solid"
+		}
+
+		fmt.Fprintf(&out, "  %s -> %s [style=%s];\n", quote(edge.From), quote(edge.To), style)
+	}
+
+	out.WriteString("}\n")
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func (graph *Graph) mermaid(w io.Writer) error {
+	var out strings.Builder
+	out.WriteString("flowchart LR\n")
+	// mermaid ids cannot contain most of the characters allowed in a path
+	ids := map[string]string{}
+	stale := make([]string, 0)
+	for index, node := range graph.Nodes {
+		id := fmt.Sprintf("n%d", index)
+		ids[node.ID] = id
+		label := strings.ReplaceAll(node.ID, `"`, "#quot;")
+		switch node.Kind {
+		case Data:
+			fmt.Fprintf(&out, "  %s[(\"%s\")]\n", id, label)
+		case Local:
+			fmt.Fprintf(&out, "  %s([\"%s\"])\n", id, label)
+		default:
+			fmt.Fprintf(&out, "  %s[\"%s\"]\n", id, label)
+		}
+
+		if node.Stale {
+			stale = append(stale, id)
+		}
+	}
+
+	for _, edge := range graph.Edges {
+		arrow := "-.->"
+		if edge.Explicit {
+			arrow = "-->"
+		}
+
+		fmt.Fprintf(&out, "  %s %s %s\n", ids[edge.From], arrow, ids[edge.To])
+	}
+
+	if len(stale) > 0 {
+		out.WriteString("  classDef stale fill:#f4cccc,stroke:#cc0000\n")
+		fmt.Fprintf(&out, "  class %s stale\n", strings.Join(stale, ","))
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func quote(id string) string {
+	return `"` + strings.ReplaceAll(id, `"`, `\"`) + `"`
+}
@@ -1,20 +1,31 @@
 package lang
 
 import (
+	"bake/internal/concurrent"
+	"bake/internal/event"
 	"bake/internal/lang/config"
 	"bake/internal/lang/schema"
+	"bake/internal/paths"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/zclconf/go-cty/cty"
 )
 
-func NewPartialAddress(block *hcl.Block) ([]config.RawAddress, hcl.Diagnostics) {
+// NewPartialAddress of the block found in the recipes of module
+func NewPartialAddress(block *hcl.Block, module *Module) ([]config.RawAddress, hcl.Diagnostics) {
 	switch block.Type {
 	case schema.DataLabel:
+		diags := schema.ValidateInstances(block)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
 		return []config.RawAddress{addressBlock{
-			Block: block,
+			Block:  block,
+			module: module,
 		}}, nil
 	case schema.TaskLabel:
 		diags := checkDescription(block)
@@ -22,8 +33,23 @@ func NewPartialAddress(block *hcl.Block) ([]config.RawAddress, hcl.Diagnostics)
 			return nil, diags
 		}
 
+		diags = schema.ValidateInstances(block)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		if block.Labels[0] == schema.ModuleLabel {
+			return nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf(`"%s" is reserved for modules and cannot be used as task name`, schema.ModuleLabel),
+				Subject:  &block.LabelRanges[0],
+				Context:  &block.DefRange,
+			}}
+		}
+
 		return []config.RawAddress{addressBlock{
-			Block: block,
+			Block:  block,
+			module: module,
 		}}, nil
 	case schema.LocalsLabel:
 		attributes, diagnostics := block.Body.JustAttributes()
@@ -34,8 +60,9 @@ func NewPartialAddress(block *hcl.Block) ([]config.RawAddress, hcl.Diagnostics)
 		addrs := make([]config.RawAddress, 0)
 		for name, attribute := range attributes {
 			addrs = append(addrs, Local{
-				name: name,
-				expr: attribute.Expr,
+				name:   name,
+				expr:   attribute.Expr,
+				module: module,
 			})
 		}
 
@@ -52,7 +79,7 @@ func NewPartialAddress(block *hcl.Block) ([]config.RawAddress, hcl.Diagnostics)
 }
 
 func checkDescription(block *hcl.Block) hcl.Diagnostics {
-	attrs, diags := block.Body.JustAttributes()
+	attrs, diags := schema.Attributes(block.Body)
 	if diags.HasErrors() {
 		return diags
 	}
@@ -72,7 +99,8 @@ func checkDescription(block *hcl.Block) hcl.Diagnostics {
 }
 
 type addressBlock struct {
-	Block *hcl.Block
+	Block  *hcl.Block
+	module *Module
 }
 
 func (n addressBlock) GetFilename() string {
@@ -82,27 +110,87 @@ func (n addressBlock) GetFilename() string {
 func (n addressBlock) GetPath() cty.Path {
 	name := n.Block.Labels[0]
 	if n.Block.Type == schema.TaskLabel {
-		return cty.GetAttrPath(name)
+		return n.module.prefix(cty.GetAttrPath(name))
 	}
 
-	return cty.GetAttrPath(n.Block.Type).GetAttr(name)
+	return n.module.prefix(cty.GetAttrPath(n.Block.Type).GetAttr(name))
 }
 
 func (n addressBlock) Dependencies() ([]hcl.Traversal, hcl.Diagnostics) {
-	attributes, diagnostics := n.Block.Body.JustAttributes()
+	traversals, diags := schema.Variables(n.Block.Body)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return n.module.traversals(traversals), nil
+}
+
+// DependsOn returns the explicit dependencies of the block. References to an instance, ex: gen[1],
+// only narrow down which changes make the block run again; all instances of gen are still applied
+func (n addressBlock) DependsOn() ([]hcl.Traversal, hcl.Diagnostics) {
+	attributes, diagnostics := schema.Attributes(n.Block.Body)
 	if diagnostics.HasErrors() {
 		return nil, diagnostics
 	}
 
-	deps := make([]hcl.Traversal, 0)
-	for _, attribute := range attributes {
-		deps = append(deps, attribute.Expr.Variables()...)
+	attribute, ok := attributes[schema.DependsOnAttr]
+	if !ok {
+		return nil, nil
 	}
 
-	return deps, nil
+	traversals, diags := schema.TupleOfReferences(attribute)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return n.module.traversals(traversals), nil
+}
+
+// Instances of the block known without decoding it, ex: count = 2 but not count = var.workers
+func (n addressBlock) Instances() cty.Value {
+	attributes, diags := schema.Attributes(n.Block.Body)
+	if diags.HasErrors() {
+		return cty.DynamicVal
+	}
+
+	if _, ok := attributes[schema.CountAttr]; ok {
+		count, _, diags := schema.Count(n.Block, nil)
+		if diags.HasErrors() {
+			return cty.UnknownVal(cty.List(cty.DynamicPseudoType))
+		}
+
+		instances := make([]cty.Value, count)
+		for index := range instances {
+			instances[index] = cty.NullVal(cty.DynamicPseudoType)
+		}
+
+		return cty.TupleVal(instances)
+	}
+
+	if _, ok := attributes[schema.ForEachAttr]; ok {
+		entries, diags := schema.ForEachEntries(n.Block, nil)
+		if diags.HasErrors() {
+			return cty.UnknownVal(cty.Map(cty.DynamicPseudoType))
+		}
+
+		// an empty for_each declares a single instance; see newTask
+		if len(entries) == 0 {
+			return cty.NullVal(cty.DynamicPseudoType)
+		}
+
+		instances := map[string]cty.Value{}
+		for key := range entries {
+			instances[key] = cty.NullVal(cty.DynamicPseudoType)
+		}
+
+		return cty.MapVal(instances)
+	}
+
+	return cty.NullVal(cty.DynamicPseudoType)
 }
 
 func (addr addressBlock) Decode(ctx *hcl.EvalContext) (config.Action, hcl.Diagnostics) {
+	ctx = addr.module.evalContext(ctx)
 	switch addr.Block.Type {
 	case schema.TaskLabel:
 		tasks, diagnostics := newTask(addr, ctx)
@@ -131,17 +219,16 @@ func (addr addressBlock) Decode(ctx *hcl.EvalContext) (config.Action, hcl.Diagno
 func applyIndexed[T config.RuntimeInstance](instances []T, state *config.State) *sync.WaitGroup {
 	wait := &sync.WaitGroup{}
 	for _, app := range instances {
+		if !state.Targets(app.GetPath()) {
+			continue
+		}
+
 		app := app
 		wait.Add(1)
 		state.Group.Go(func() error {
 			defer wait.Done()
 
-			diags := app.Apply(state)
-			if diags.HasErrors() {
-				return diags
-			}
-
-			return nil
+			return applyInstance(app, state)
 		})
 	}
 
@@ -154,13 +241,47 @@ func applySingle(instance config.RuntimeInstance, state *config.State) *sync.Wai
 	state.Group.Go(func() error {
 		defer wait.Done()
 
-		diags := instance.Apply(state)
-		if diags.HasErrors() {
-			return diags
-		}
+		return applyInstance(instance, state)
+	})
+
+	return wait
+}
 
+// applyInstance once a job slot is available such that all instances
+// share the same parallelism budget
+func applyInstance(instance config.RuntimeInstance, state *config.State) error {
+	log := state.Events.Logger(paths.String(instance.GetPath()))
+	queued := time.Now()
+	lease, err := state.Jobs.Lease(state.Context)
+	if err != nil {
+		// cancelled; whoever cancelled it reports the reason
 		return nil
+	}
+	defer lease.Release()
+
+	log.Span(event.Queue, queued, lease.Slot())
+	// the instance hands back its slot while waiting, ex: between retries. So
+	// it executes on every slot it held; possibly a different one each time
+	diags := instance.Apply(state.WithContext(concurrent.WithLease(state.Context, lease)))
+	for _, hold := range lease.Holds() {
+		log.SpanFor(event.Execute, hold.Start, hold.Duration, hold.Slot)
+	}
+
+	if !diags.HasErrors() {
+		return nil
+	}
+
+	state.Events.Publish(event.Event{
+		Kind:        event.TaskFailed,
+		Task:        paths.String(instance.GetPath()),
+		Diagnostics: diags,
 	})
 
-	return wait
+	if state.Flags.KeepGoing {
+		// don't cancel the other instances; the coordinator skips those that depend on this one
+		state.Failures.Append(config.Failure{Path: instance.GetPath(), Diagnostics: diags})
+		return nil
+	}
+
+	return diags
 }
@@ -0,0 +1,104 @@
+package lang
+
+import (
+	"testing"
+
+	"bake/internal/lang/schema"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestNewPartialAddressInstances(t *testing.T) {
+	tests := []struct {
+		name    string
+		recipe  string
+		summary string
+	}{
+		{name: "count", recipe: `task "build" { count = 2 }`},
+		{name: "for_each", recipe: `task "build" { for_each = toset(["a"]) }`},
+		{name: "task with both", recipe: `task "build" {
+  count    = 2
+  for_each = toset(["a"])
+}`, summary: `"count" and "for_each" are mutually exclusive`},
+		{name: "data with both", recipe: `data "version" {
+  count    = 2
+  for_each = toset(["a"])
+}`, summary: `"count" and "for_each" are mutually exclusive`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			file, diags := hclparse.NewParser().ParseHCL([]byte(test.recipe), "main.hcl")
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			content, diags := file.Body.Content(schema.FileSchema())
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			// act
+			_, diags = NewPartialAddress(content.Blocks[0], NewRootModule(t.TempDir()))
+
+			// assert
+			if test.summary == "" {
+				if diags.HasErrors() {
+					t.Errorf("unexpected diagnostics %s", diags)
+				}
+
+				return
+			}
+
+			if !diags.HasErrors() || diags[0].Summary != test.summary {
+				t.Errorf(`expected "%s" but got %s`, test.summary, diags)
+			}
+		})
+	}
+}
+
+func TestInstances(t *testing.T) {
+	null := cty.NullVal(cty.DynamicPseudoType)
+	tests := []struct {
+		name   string
+		recipe string
+		want   cty.Value
+	}{
+		{name: "single", recipe: `task "build" {}`, want: null},
+		{name: "count", recipe: `task "build" { count = 2 }`, want: cty.TupleVal([]cty.Value{null, null})},
+		{name: "count of a variable", recipe: `task "build" { count = var.workers }`, want: cty.UnknownVal(cty.List(cty.DynamicPseudoType))},
+		{name: "for_each", recipe: `data "version" { for_each = { a = "1.0" } }`, want: cty.MapVal(map[string]cty.Value{"a": null})},
+		{name: "for_each of a function", recipe: `task "build" { for_each = toset(["a"]) }`, want: cty.UnknownVal(cty.Map(cty.DynamicPseudoType))},
+		{name: "empty for_each", recipe: `task "build" { for_each = {} }`, want: null},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			file, diags := hclparse.NewParser().ParseHCL([]byte(test.recipe), "main.hcl")
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			content, diags := file.Body.Content(schema.FileSchema())
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			addresses, diags := NewPartialAddress(content.Blocks[0], NewRootModule(t.TempDir()))
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			// act
+			instances := addresses[0].(addressBlock).Instances()
+
+			// assert
+			if !instances.RawEquals(test.want) {
+				t.Errorf("expected %#v but got %#v", test.want, instances)
+			}
+		})
+	}
+}
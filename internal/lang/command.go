@@ -0,0 +1,236 @@
+package lang
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bake/internal/event"
+	"bake/internal/lang/config"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// DefaultShell is used whenever $SHELL is not a POSIX shell, ex: fish
+const DefaultShell = "bash"
+
+// preambles make POSIX shells fail fast; keyed by the name of the shell
+var preambles = map[string]string{
+	"bash": "set -euo pipefail",
+	"ksh":  "set -euo pipefail",
+	"mksh": "set -euo pipefail",
+	"zsh":  "set -euo pipefail",
+	"sh":   "set -eu",
+	"dash": "set -eu",
+	"ash":  "set -eu",
+}
+
+// command run by tasks and data; either a script run by an interpreter, ex: ["python3", "-c"],
+// or the argv of a program run without any shell, ex: command = ["go", "build", "./..."]
+type command struct {
+	script string
+	argv   []string
+	// explicitly declared by the recipes; the user's shell otherwise
+	interpreter []string
+}
+
+// newCommand decodes the command of a task or data of module. Their own interpreter takes
+// precedence over the one of the module; it is ignored by argv commands
+func newCommand(value cty.Value, interpreter []string, module *Module, subject, interpreterSubject, context *hcl.Range) (command, hcl.Diagnostics) {
+	if interpreter != nil && len(interpreter) == 0 {
+		return command{}, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  `"interpreter" must contain at least the program to run, ex: ["python3", "-c"]`,
+			Subject:  interpreterSubject,
+			Context:  context,
+		}}
+	}
+
+	if interpreter == nil {
+		interpreter = module.defaultInterpreter()
+	}
+
+	if value.IsNull() {
+		return command{interpreter: interpreter}, nil
+	}
+
+	if value.Type().Equals(cty.String) {
+		return command{script: value.AsString(), interpreter: interpreter}, nil
+	}
+
+	var argv []string
+	list, err := convert.Convert(value, cty.List(cty.String))
+	if err == nil {
+		err = gocty.FromCtyValue(list, &argv)
+	}
+
+	if err != nil {
+		return command{}, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  `"command" must be either a string or a list of strings`,
+			Detail:   err.Error(),
+			Subject:  subject,
+			Context:  context,
+		}}
+	}
+
+	if len(argv) == 0 {
+		return command{}, nil
+	}
+
+	return command{argv: argv}, nil
+}
+
+func (c command) empty() bool {
+	return c.script == "" && len(c.argv) == 0
+}
+
+// String representation of the command; only changes if the command or its declared interpreter do
+func (c command) String() string {
+	if c.argv != nil {
+		return strings.Join(c.argv, "\x00")
+	}
+
+	if c.interpreter != nil {
+		return strings.Join(append(append([]string{}, c.interpreter...), c.script), "\x00")
+	}
+
+	return c.script
+}
+
+// args are the program and arguments to run. POSIX shells run the script after a fail fast preamble
+func (c command) args() []string {
+	if c.argv != nil {
+		return c.argv
+	}
+
+	interpreter := c.interpreter
+	if interpreter == nil {
+		interpreter = []string{userShell(), "-c"}
+	}
+
+	script := c.script
+	if preamble, ok := preambles[filepath.Base(interpreter[0])]; ok {
+		script = fmt.Sprintf(`
+	%s
+
+	%s`, preamble, c.script)
+	}
+
+	return append(append([]string{}, interpreter...), script)
+}
+
+// userShell is the shell from $SHELL as long as it is a POSIX shell. Zsh is only
+// used if explicitly declared since it doesn't follow POSIX by default
+func userShell() string {
+	shell, ok := os.LookupEnv("SHELL")
+	if !ok || filepath.Base(shell) == "zsh" {
+		return DefaultShell
+	}
+
+	if _, posix := preambles[filepath.Base(shell)]; !posix {
+		return DefaultShell
+	}
+
+	return shell
+}
+
+// execution of a command
+type execution struct {
+	stdout   string
+	stderr   string
+	exitCode int64
+	// state of the process, ex: "exit status 1"
+	state    string
+	duration time.Duration
+	timedOut bool
+	err      error
+}
+
+// detail of the execution for diagnostics; stderr unless the program didn't write anything to it
+func (e execution) detail() string {
+	if e.stderr == "" {
+		return e.stdout
+	}
+
+	return e.stderr
+}
+
+// run the command in dir with env while streaming its output to log. The command is stopped
+// after timeout unless it is zero
+func (c command) run(ctx context.Context, log *event.Logger, mode, dir string, env map[string]string, timeout time.Duration) execution {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// keep the output for the diagnostics while streaming it
+	var stdout, stderr bytes.Buffer
+	stdoutLines, stderrLines := log.Writer(event.Stdout), log.Writer(event.Stderr)
+	log.Started(mode)
+	start := time.Now()
+	result := execution{exitCode: -1}
+	if c.builtin() {
+		c.interpret(ctx, &result, dir, env, io.MultiWriter(&stdout, stdoutLines), io.MultiWriter(&stderr, stderrLines))
+	} else {
+		c.exec(ctx, &result, dir, env, io.MultiWriter(&stdout, stdoutLines), io.MultiWriter(&stderr, stderrLines))
+	}
+
+	result.duration = time.Since(start)
+	stdoutLines.Flush()
+	stderrLines.Flush()
+	result.stdout = strings.TrimSpace(stdout.String())
+	result.stderr = strings.TrimSpace(stderr.String())
+	result.timedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	// command.ProcessState.UserTime().String() provides inconsistent results
+	// if the process is just iddling
+	log.Finished(result.exitCode, result.duration)
+	return result
+}
+
+// output of the command run in dir; stdout and stderr combined. Meant for short lived
+// commands whose output is not streamed, ex: the version probe of a tool
+func (c command) output(ctx context.Context, dir string) (string, error) {
+	args := c.args()
+	process := exec.Command(args[0], args[1:]...)
+	process.Dir = dir
+	var output bytes.Buffer
+	process.Stdout = &output
+	process.Stderr = &output
+	err := runProcess(ctx, process)
+	result := strings.TrimSpace(output.String())
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, result)
+	}
+
+	return result, nil
+}
+
+// exec the command as a separate process
+func (c command) exec(ctx context.Context, result *execution, dir string, env map[string]string, stdout, stderr io.Writer) {
+	args := c.args()
+	process := exec.Command(args[0], args[1:]...)
+	process.Dir = dir
+	process.Env = config.EnvSlice(env)
+	process.Stdout = stdout
+	process.Stderr = stderr
+	result.err = runProcess(ctx, process)
+	// the process might not even start, ex: the program doesn't exist
+	if process.ProcessState != nil {
+		result.exitCode = int64(process.ProcessState.ExitCode())
+		result.state = process.ProcessState.String()
+	} else if result.err != nil {
+		result.state = result.err.Error()
+	}
+}
@@ -0,0 +1,136 @@
+package lang
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"bake/internal/lang/config"
+
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// BuiltinShell is the interpreter embedded in bake, ex: interpreter = ["builtin"]. Scripts
+// behave the same on every machine since only the programs they call are external
+const BuiltinShell = "builtin"
+
+// pipelineStatus is run after each pipeline of the builtin shell with its exit status, since
+// mvdan.cc/sh only exits on errors of simple commands; with "-o pipefail" the pipelines still
+// set "$?" but never stop the script
+const pipelineStatus = "__bake_pipeline_status"
+
+func (c command) builtin() bool {
+	return c.argv == nil && len(c.interpreter) > 0 && c.interpreter[0] == BuiltinShell
+}
+
+// interpret the script with the builtin shell; with "set -euo pipefail" as the bash preamble
+func (c command) interpret(ctx context.Context, result *execution, dir string, env map[string]string, stdout, stderr io.Writer) {
+	file, err := syntax.NewParser().Parse(strings.NewReader(c.script), "")
+	if err != nil {
+		result.err = err
+		result.state = err.Error()
+		return
+	}
+
+	syntax.Walk(file, checkPipelines)
+	runner, err := interp.New(
+		interp.Dir(dir),
+		interp.Env(expand.ListEnviron(config.EnvSlice(env)...)),
+		interp.StdIO(nil, stdout, stderr),
+		interp.ExecHandler(execHandler(interp.DefaultExecHandler(KillGracePeriod))),
+		interp.Params("-e", "-u", "-o", "pipefail"),
+	)
+	if err != nil {
+		result.err = err
+		result.state = err.Error()
+		return
+	}
+
+	result.err = runner.Run(ctx, file)
+	if result.err == nil {
+		result.exitCode = 0
+		result.state = "exit status 0"
+		return
+	}
+
+	status, ok := interp.IsExitStatus(result.err)
+	if !ok {
+		result.state = result.err.Error()
+		return
+	}
+
+	result.exitCode = int64(status)
+	result.state = fmt.Sprintf("exit status %d", status)
+}
+
+// checkPipelines adds the check of the exit status after the pipelines of the statements of
+// node; it's a simple command so "-e" applies to it except in conditions as with the pipelines
+func checkPipelines(node syntax.Node) bool {
+	switch node := node.(type) {
+	case *syntax.File:
+		node.Stmts = withPipelineStatus(node.Stmts)
+	case *syntax.Block:
+		node.Stmts = withPipelineStatus(node.Stmts)
+	case *syntax.Subshell:
+		node.Stmts = withPipelineStatus(node.Stmts)
+	case *syntax.CmdSubst:
+		node.Stmts = withPipelineStatus(node.Stmts)
+	case *syntax.ProcSubst:
+		node.Stmts = withPipelineStatus(node.Stmts)
+	case *syntax.CaseItem:
+		node.Stmts = withPipelineStatus(node.Stmts)
+	case *syntax.IfClause:
+		node.Cond = withPipelineStatus(node.Cond)
+		node.Then = withPipelineStatus(node.Then)
+	case *syntax.WhileClause:
+		node.Cond = withPipelineStatus(node.Cond)
+		node.Do = withPipelineStatus(node.Do)
+	case *syntax.ForClause:
+		node.Do = withPipelineStatus(node.Do)
+	}
+
+	return true
+}
+
+func withPipelineStatus(stmts []*syntax.Stmt) []*syntax.Stmt {
+	result := make([]*syntax.Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		result = append(result, stmt)
+		pipeline, ok := stmt.Cmd.(*syntax.BinaryCmd)
+		if !ok || stmt.Negated || stmt.Background || stmt.Coprocess {
+			continue
+		}
+
+		if pipeline.Op != syntax.Pipe && pipeline.Op != syntax.PipeAll {
+			continue
+		}
+
+		// pipelineStatus $?
+		result = append(result, &syntax.Stmt{Cmd: &syntax.CallExpr{Args: []*syntax.Word{
+			{Parts: []syntax.WordPart{&syntax.Lit{Value: pipelineStatus}}},
+			{Parts: []syntax.WordPart{&syntax.ParamExp{Short: true, Param: &syntax.Lit{Value: "?"}}}},
+		}}})
+	}
+
+	return result
+}
+
+// execHandler runs the programs of the script with next except the check of the pipelines
+func execHandler(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(ctx context.Context, args []string) error {
+		if args[0] != pipelineStatus {
+			return next(ctx, args)
+		}
+
+		status, err := strconv.Atoi(args[1])
+		if err != nil || status == 0 {
+			return err
+		}
+
+		return interp.NewExitStatus(uint8(status))
+	}
+}
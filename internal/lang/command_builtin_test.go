@@ -0,0 +1,93 @@
+package lang
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterpret(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		env      map[string]string
+		stdout   string
+		exitCode int64
+		state    string
+	}{
+		{name: "success", script: "echo hi", stdout: "hi", exitCode: 0, state: "exit status 0"},
+		{name: "cd", script: "mkdir sub && cd sub && basename $(pwd)", stdout: "sub", exitCode: 0, state: "exit status 0"},
+		{name: "export", script: "export GREETING=hi && printenv GREETING", stdout: "hi", exitCode: 0, state: "exit status 0"},
+		{name: "env", script: "echo $GREETING", env: map[string]string{"GREETING": "hi"}, stdout: "hi", exitCode: 0, state: "exit status 0"},
+		{name: "exit code", script: "exit 3", exitCode: 3, state: "exit status 3"},
+		{name: "external exit code", script: "sh -c 'exit 4'", exitCode: 4, state: "exit status 4"},
+		{name: "errexit", script: "false\necho after", exitCode: 1, state: "exit status 1"},
+		{name: "nounset", script: "echo $BAKE_TEST_UNSET\necho after", exitCode: 1, state: "exit status 1"},
+		{name: "pipefail", script: "false | true\necho after", exitCode: 1, state: "exit status 1"},
+		{name: "pipefail status", script: "sh -c 'exit 5' | true\necho after", exitCode: 5, state: "exit status 5"},
+		{name: "pipefail in function", script: "f() {\n  false | true\n  echo after\n}\nf", exitCode: 1, state: "exit status 1"},
+		{name: "pipefail in condition", script: "if false | true; then echo true; else echo false; fi", stdout: "false", exitCode: 0, state: "exit status 0"},
+		{name: "pipefail in list", script: "false | true || echo $?", stdout: "1", exitCode: 0, state: "exit status 0"},
+		{name: "parse error", script: `echo "unterminated`, exitCode: -1, state: `1:6: reached EOF without closing quote "`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			dir := t.TempDir()
+			env := map[string]string{"PATH": os.Getenv("PATH")}
+			for name, value := range test.env {
+				env[name] = value
+			}
+
+			c := command{script: test.script, interpreter: []string{BuiltinShell}}
+			result := execution{exitCode: -1}
+			var stdout, stderr bytes.Buffer
+
+			// act
+			c.interpret(context.Background(), &result, dir, env, &stdout, &stderr)
+
+			// assert
+			if result.exitCode != test.exitCode {
+				t.Errorf("expected exit code %d but got %d: %s", test.exitCode, result.exitCode, stderr.String())
+			}
+
+			if result.state != test.state {
+				t.Errorf(`expected state "%s" but got "%s"`, test.state, result.state)
+			}
+
+			if strings.TrimSpace(stdout.String()) != test.stdout {
+				t.Errorf(`expected stdout "%s" but got "%s"`, test.stdout, stdout.String())
+			}
+		})
+	}
+}
+
+func TestInterpretCancelled(t *testing.T) {
+	// arrange
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c := command{script: "sleep 10\necho after", interpreter: []string{BuiltinShell}}
+	result := execution{exitCode: -1}
+	var stdout, stderr bytes.Buffer
+
+	// act
+	start := time.Now()
+	c.interpret(ctx, &result, t.TempDir(), map[string]string{"PATH": os.Getenv("PATH")}, &stdout, &stderr)
+
+	// assert
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the script to stop when cancelled but it took %s", elapsed)
+	}
+
+	if result.err == nil || result.exitCode == 0 {
+		t.Errorf("expected the script to fail but got exit code %d", result.exitCode)
+	}
+
+	if strings.Contains(stdout.String(), "after") {
+		t.Errorf("expected the script to stop after the cancelled command but got %q", stdout.String())
+	}
+}
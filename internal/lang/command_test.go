@@ -0,0 +1,114 @@
+package lang
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestNewCommand(t *testing.T) {
+	python := []string{"python3", "-c"}
+	module := &Module{Name: "api", interpreter: []string{"node", "-e"}, parent: NewRootModule("")}
+	tests := []struct {
+		name        string
+		value       cty.Value
+		interpreter []string
+		module      *Module
+		want        command
+		summary     string
+	}{
+		{name: "script", value: cty.StringVal("echo hi"), module: NewRootModule(""), want: command{script: "echo hi"}},
+		{name: "argv", value: cty.TupleVal([]cty.Value{cty.StringVal("go"), cty.StringVal("build")}), module: NewRootModule(""), want: command{argv: []string{"go", "build"}}},
+		{name: "empty argv", value: cty.ListValEmpty(cty.String), module: NewRootModule(""), want: command{}},
+		{name: "null", value: cty.NullVal(cty.String), module: NewRootModule(""), want: command{}},
+		{name: "interpreter", value: cty.StringVal("print(1)"), interpreter: python, module: NewRootModule(""), want: command{script: "print(1)", interpreter: python}},
+		{name: "module interpreter", value: cty.StringVal("1"), module: module, want: command{script: "1", interpreter: []string{"node", "-e"}}},
+		{name: "nested module interpreter", value: cty.StringVal("1"), module: &Module{Name: "db", parent: module}, want: command{script: "1", interpreter: []string{"node", "-e"}}},
+		{name: "own interpreter over module", value: cty.StringVal("print(1)"), interpreter: python, module: module, want: command{script: "print(1)", interpreter: python}},
+		{name: "argv ignores interpreter", value: cty.TupleVal([]cty.Value{cty.StringVal("ls")}), interpreter: python, module: module, want: command{argv: []string{"ls"}}},
+		{name: "empty interpreter", value: cty.StringVal("1"), interpreter: []string{}, module: NewRootModule(""), summary: `"interpreter" must contain at least the program to run, ex: ["python3", "-c"]`},
+		{name: "not a command", value: cty.NumberIntVal(1), module: NewRootModule(""), summary: `"command" must be either a string or a list of strings`},
+		{name: "nested lists", value: cty.TupleVal([]cty.Value{cty.ListValEmpty(cty.String)}), module: NewRootModule(""), summary: `"command" must be either a string or a list of strings`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// act
+			got, diags := newCommand(test.value, test.interpreter, test.module, nil, nil, nil)
+
+			// assert
+			if test.summary != "" {
+				if !diags.HasErrors() || diags[0].Summary != test.summary {
+					t.Errorf(`expected "%s" but got %s`, test.summary, diags)
+				}
+
+				return
+			}
+
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", test.want) {
+				t.Errorf("expected %q but got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		shell    string
+		command  command
+		program  []string
+		preamble string
+	}{
+		{name: "bash", command: command{script: "true", interpreter: []string{"bash", "-c"}}, program: []string{"bash", "-c"}, preamble: "set -euo pipefail"},
+		{name: "sh by path", command: command{script: "true", interpreter: []string{"/bin/sh", "-c"}}, program: []string{"/bin/sh", "-c"}, preamble: "set -eu"},
+		{name: "explicit zsh", command: command{script: "true", interpreter: []string{"zsh", "-c"}}, program: []string{"zsh", "-c"}, preamble: "set -euo pipefail"},
+		{name: "not a shell", command: command{script: "true", interpreter: []string{"python3", "-c"}}, program: []string{"python3", "-c"}},
+		{name: "user shell", shell: "/bin/dash", command: command{script: "true"}, program: []string{"/bin/dash", "-c"}, preamble: "set -eu"},
+		{name: "user zsh", shell: "/bin/zsh", command: command{script: "true"}, program: []string{DefaultShell, "-c"}, preamble: "set -euo pipefail"},
+		{name: "user fish", shell: "/usr/bin/fish", command: command{script: "true"}, program: []string{DefaultShell, "-c"}, preamble: "set -euo pipefail"},
+		{name: "argv", command: command{argv: []string{"go", "build"}}, program: []string{"go", "build"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			t.Setenv("SHELL", test.shell)
+
+			// act
+			args := test.command.args()
+
+			// assert
+			if test.command.argv != nil {
+				if strings.Join(args, " ") != strings.Join(test.program, " ") {
+					t.Errorf("expected %v but got %v", test.program, args)
+				}
+
+				return
+			}
+
+			program, script := args[:len(args)-1], args[len(args)-1]
+			if strings.Join(program, " ") != strings.Join(test.program, " ") {
+				t.Errorf("expected %v but got %v", test.program, program)
+			}
+
+			if !strings.HasSuffix(script, test.command.script) {
+				t.Errorf(`expected the script to end with "%s" but got "%s"`, test.command.script, script)
+			}
+
+			if test.preamble == "" && script != test.command.script {
+				t.Errorf(`expected no preamble but got "%s"`, script)
+			}
+
+			if test.preamble != "" && !strings.Contains(script, test.preamble) {
+				t.Errorf(`expected preamble "%s" but got "%s"`, test.preamble, script)
+			}
+		})
+	}
+}
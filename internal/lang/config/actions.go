@@ -11,31 +11,71 @@ import (
 type Actions []Action
 
 func (actions Actions) EvalContext() map[string]cty.Value {
-	variables := map[string]cty.Value{}
-	data := map[string]cty.Value{}
-	local := map[string]cty.Value{}
-	task := map[string]cty.Value{}
+	root := newScope()
 	for _, act := range actions {
 		path := act.GetPath()
+		current := root
+		// actions of modules are nested under module.<name>
+		for len(path) > 2 && path.HasPrefix(schema.ModulePrefix) {
+			current = current.module(paths.StepString(path[1]))
+			path = path[2:]
+		}
+
 		value := act.CTY()
 		switch {
 		case path.HasPrefix(schema.DataPrefix):
 			name := paths.StepString(path[1])
-			data[name] = value
+			current.data[name] = value
 		case path.HasPrefix(schema.LocalPrefix):
 			name := paths.StepString(path[1])
-			local[name] = value
+			current.local[name] = value
 		default:
 			name := paths.StepString(path[0])
-			task[name] = value
+			current.task[name] = value
 		}
 	}
 
-	variables[schema.DataLabel] = cty.ObjectVal(data)
-	variables[schema.LocalScope] = cty.ObjectVal(local)
-	variables[schema.TaskLabel] = cty.ObjectVal(task)
+	return root.variables()
+}
+
+// scope are the values visible to the recipes of a single module
+type scope struct {
+	data    map[string]cty.Value
+	local   map[string]cty.Value
+	task    map[string]cty.Value
+	modules map[string]*scope
+}
+
+func newScope() *scope {
+	return &scope{
+		data:    map[string]cty.Value{},
+		local:   map[string]cty.Value{},
+		task:    map[string]cty.Value{},
+		modules: map[string]*scope{},
+	}
+}
+
+func (s *scope) module(name string) *scope {
+	if _, ok := s.modules[name]; !ok {
+		s.modules[name] = newScope()
+	}
+
+	return s.modules[name]
+}
+
+func (s *scope) variables() map[string]cty.Value {
+	modules := map[string]cty.Value{}
+	for name, module := range s.modules {
+		modules[name] = cty.ObjectVal(module.variables())
+	}
+
+	variables := map[string]cty.Value{}
+	variables[schema.DataLabel] = cty.ObjectVal(s.data)
+	variables[schema.LocalScope] = cty.ObjectVal(s.local)
+	variables[schema.TaskLabel] = cty.ObjectVal(s.task)
+	variables[schema.ModuleLabel] = cty.ObjectVal(modules)
 	// allow tasks to be referred without a prefix
-	concurrent.Merge(variables, task)
+	concurrent.Merge(variables, s.task)
 
 	return variables
 }
@@ -0,0 +1,26 @@
+package config
+
+import "github.com/hashicorp/hcl/v2"
+
+// Explainer is implemented by actions that know why they would run. Only
+// meaningful after applying them in a dry run
+type Explainer interface {
+	Explain() []Explanation
+}
+
+// Explanation of why an instance of an action would run or not
+type Explanation struct {
+	Path string
+	// Stale are all the reasons for the instance to run; empty if it would be skipped
+	Stale []Staleness
+	// Skip is the reason for the instance not to run
+	Skip string
+}
+
+// Staleness is a reason for an instance to run together with the attribute responsible for it
+type Staleness struct {
+	Reason  string
+	Subject *hcl.Range
+	// Dependencies that changed their outputs; if that is the reason
+	Dependencies []string
+}
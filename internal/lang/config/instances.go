@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+
+	"bake/internal/lang/schema"
+	"bake/internal/paths"
+	"bake/internal/util"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// CheckInstance fails if path refers to an instance that its address doesn't declare, ex: gen[5]
+// or gen["x"] when gen has count = 2. instances is shaped as the value of the address; see
+// Instances. Only the type of the index is checked while the instances are unknown
+func CheckInstance(path cty.Path, instances cty.Value, subject *hcl.Range) hcl.Diagnostics {
+	step, ok := path[len(path)-1].(cty.IndexStep)
+	if !ok || (instances.Type() == cty.DynamicPseudoType && !instances.IsKnown()) {
+		return nil
+	}
+
+	address := path[:len(path)-1]
+	name := paths.String(address)
+	ty := instances.Type()
+	detail := fmt.Sprintf(`"%s" has a single instance; refer to it without an index`, name)
+	options := []string{name}
+	switch {
+	case ty.IsTupleType() || ty.IsListType() || ty.IsMapType():
+		found := instances.HasIndex(step.Key)
+		if !found.IsKnown() || found.True() {
+			return nil
+		}
+
+		detail = fmt.Sprintf(`the instances of "%s" are indexed by number since it has "%s"`, name, schema.CountAttr)
+		if ty.IsMapType() {
+			detail = fmt.Sprintf(`the instances of "%s" are indexed by string since it has "%s"`, name, schema.ForEachAttr)
+		}
+
+		options = make([]string, 0)
+		if !instances.IsKnown() {
+			break
+		}
+
+		for iterator := instances.ElementIterator(); iterator.Next(); {
+			key, _ := iterator.Element()
+			options = append(options, paths.String(address.Index(key)))
+		}
+	}
+
+	summary := "couldn't find any instance with name " + paths.String(path)
+	if suggestion := util.Suggest(paths.String(path), options); suggestion != "" {
+		summary += fmt.Sprintf(`. Did you mean "%s"`, suggestion)
+	}
+
+	return hcl.Diagnostics{{
+		Severity: hcl.DiagError,
+		Summary:  summary,
+		Detail:   detail,
+		Subject:  subject,
+	}}
+}
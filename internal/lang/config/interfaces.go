@@ -26,6 +26,7 @@ type RuntimeAction interface {
 }
 
 type RuntimeInstance interface {
+	GetPath() cty.Path
 	Apply(state *State) hcl.Diagnostics
 }
 
@@ -35,6 +36,33 @@ type RawAddress interface {
 	Decode(ctx *hcl.EvalContext) (Action, hcl.Diagnostics)
 }
 
+// ExplicitDependencies is implemented by raw addresses that can declare
+// dependencies explicitly (depends_on) instead of through their expressions
+type ExplicitDependencies interface {
+	DependsOn() ([]hcl.Traversal, hcl.Diagnostics)
+}
+
+// Instances is implemented by raw addresses that might declare several instances, ex: count = 2
+type Instances interface {
+	// Instances returns a value shaped as the decoded address; a tuple for count, a map for
+	// for_each and null otherwise. Unknown if count or for_each cannot be evaluated yet
+	Instances() cty.Value
+}
+
+// Changer is implemented by actions that know whether applying them
+// changed their outputs; only those of the instances referred by path
+type Changer interface {
+	Changed(path cty.Path) bool
+	// Outputs returns the digest of the outputs of each instance referred by path; by their name
+	Outputs(path cty.Path) map[string]string
+}
+
+// Dependent is implemented by actions that react to changes on the outputs
+// of their explicit dependencies; including those from previous runs
+type Dependent interface {
+	Upstream(changed []string, outputs map[string]string)
+}
+
 func AddressToString[T Address](addr T) string {
 	return paths.String(addr.GetPath())
 }
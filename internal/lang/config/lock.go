@@ -1,6 +1,7 @@
 package config
 
 import (
+	"bake/internal/digest"
 	"bake/internal/info"
 	"bake/internal/paths"
 	"encoding/json"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
 )
 
 const (
@@ -31,12 +33,42 @@ type Hash struct {
 	Path string
 	// Dirty flags a Hash as comming from a Task that might have not exit correctly
 	Dirty bool `json:"-"`
-	// Creates keep a ref to the old filename in case it is renamed
-	Creates string
+	// Creates keep a ref to the old outputs in case they are renamed; relative to the root recipes
+	Creates Outputs
 	// Env hash just to check if it changes between executions
 	Env string
+	// EnvVars keep a hash of every env var that the task depends on; to tell which one changed
+	EnvVars map[string]string
 	// Command hash just to check if it changes between executions
 	Command string
+	// Tools keep the version of every external tool used by the task
+	Tools map[string]string `json:",omitempty"`
+	// Sources keep the digest of every file matched by the task sources
+	Sources map[string]digest.File `json:",omitempty"`
+	// Targets keep the digest of every file created by the task
+	Targets map[string]digest.File `json:",omitempty"`
+	// Dependencies keep the digest of the outputs of every explicit dependency; by their name
+	Dependencies map[string]string `json:",omitempty"`
+	// Upstream keeps the explicit dependencies that changed while the task didn't succeed
+	Upstream []string `json:",omitempty"`
+}
+
+// Outputs are the paths and glob patterns of the files created by a task
+type Outputs []string
+
+// UnmarshalJSON also accepts a single filename as written by older versions
+func (outputs *Outputs) UnmarshalJSON(data []byte) error {
+	var filename string
+	if json.Unmarshal(data, &filename) == nil {
+		*outputs = nil
+		if filename != "" {
+			*outputs = Outputs{filename}
+		}
+
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(outputs))
 }
 
 func newLock() *Lock {
@@ -73,7 +105,12 @@ func (lock *Lock) Update(hasher Hasher) {
 	lock.Timestamp = time.Now()
 	hashes := hasher.Hash()
 	for _, hash := range hashes {
-		if hash.Dirty || hash.Creates == "" {
+		if hash.Dirty {
+			lock.keepUpstream(hash)
+			continue
+		}
+
+		if len(hash.Creates) == 0 {
 			continue
 		}
 
@@ -94,6 +131,22 @@ func (lock *Lock) Update(hasher Hasher) {
 	}
 }
 
+// keepUpstream merges the changes of the explicit dependencies of a task that didn't
+// succeed into its previous hash so that the task still runs on the next run
+func (lock *Lock) keepUpstream(hash Hash) {
+	for index := range lock.Tasks {
+		if lock.Tasks[index].Path != hash.Path {
+			continue
+		}
+
+		for _, name := range hash.Upstream {
+			if !slices.Contains(lock.Tasks[index].Upstream, name) {
+				lock.Tasks[index].Upstream = append(lock.Tasks[index].Upstream, name)
+			}
+		}
+	}
+}
+
 func (lock *Lock) Get(path cty.Path) (*Hash, bool) {
 	for _, hash := range lock.Tasks {
 		if hash.Path == paths.String(path) {
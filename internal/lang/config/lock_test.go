@@ -0,0 +1,68 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestOutputsUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		want  Outputs
+		fails bool
+	}{
+		{name: "single filename from older versions", data: `"out.bin"`, want: Outputs{"out.bin"}},
+		{name: "empty filename from older versions", data: `""`, want: nil},
+		{name: "null", data: `null`, want: nil},
+		{name: "list", data: `["out.bin", "dist/**/*.js"]`, want: Outputs{"out.bin", "dist/**/*.js"}},
+		{name: "invalid", data: `1`, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// act
+			var got Outputs
+			err := json.Unmarshal([]byte(test.data), &got)
+
+			// assert
+			if (err != nil) != test.fails {
+				t.Fatalf("expected failure %t but got %v", test.fails, err)
+			}
+
+			if fmt.Sprintf("%#v", got) != fmt.Sprintf("%#v", test.want) && !test.fails {
+				t.Errorf("expected %#v but got %#v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestLockFromOlderVersion(t *testing.T) {
+	// arrange
+	data := `{"Version": "0.1.0", "Tasks": [{"Path": "build", "Creates": "out.bin", "Command": "1"}]}`
+
+	// act
+	var lock Lock
+	err := json.Unmarshal([]byte(data), &lock)
+
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, ok := lock.Get(cty.GetAttrPath("build"))
+	if !ok {
+		t.Fatal("expected the hash of build")
+	}
+
+	if len(hash.Creates) != 1 || hash.Creates[0] != "out.bin" {
+		t.Errorf(`expected ["out.bin"] but got %v`, hash.Creates)
+	}
+
+	if hash.Targets != nil || hash.EnvVars != nil {
+		t.Errorf("expected no digests from an older version")
+	}
+}
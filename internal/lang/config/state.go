@@ -1,10 +1,16 @@
 package config
 
 import (
+	"bake/internal/cache"
+	"bake/internal/concurrent"
+	"bake/internal/event"
 	"bake/internal/lang/schema"
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/hcl/v2"
@@ -19,14 +25,35 @@ type State struct {
 	Flags   StateFlags
 	Lock    *Lock
 	Group   *errgroup.Group
+	// Jobs limits the amount of instances running at the same time
+	Jobs *concurrent.Pool
+	// Failures of instances that didn't stop the run; see StateFlags.KeepGoing
+	Failures *concurrent.Slice[Failure]
+	Tools    *Tools
+	Cache    *cache.Cache
+	// Events of the run; shared by all forks
+	Events *event.Bus
+	// VarFlags are the values of variables set through the cli
+	VarFlags []VariableValue
+	// Variables are the values of all variables declared by the recipes; available as var.name
+	Variables map[string]cty.Value
+	// Instance requested by the user, ex: build[0]; nil to apply all instances of the task
+	Instance cty.Path
 }
 
-const DefaultParallelism = 4
+const (
+	DefaultParallelism = 4
+	BakeCacheDirname   = "cache"
+	// CacheSizeEnv is the max size of the local cache in bytes
+	CacheSizeEnv = "BAKE_CACHE_SIZE"
+	// JobsEnv is the amount of instances to run in parallel; 0 means one per cpu
+	JobsEnv = "BAKE_JOBS"
+	// OutputJSON renders the events of a run as json instead of text; see event.Modes for the others
+	OutputJSON = "json"
+)
 
 func NewState(ctx context.Context) (*State, error) {
-	bounded, ctx := errgroup.WithContext(ctx)
-	// todo: read this from env vars or similar
-	bounded.SetLimit(DefaultParallelism)
+	bounded, ctx := newGroup(ctx)
 	// where are we?
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -39,15 +66,94 @@ func NewState(ctx context.Context) (*State, error) {
 		return nil, err
 	}
 
+	jobs := DefaultParallelism
+	if value, ok := os.LookupEnv(JobsEnv); ok {
+		jobs, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", JobsEnv, err)
+		}
+	}
+
+	pool, err := NewJobs(jobs)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSize := int64(cache.DefaultMaxSize)
+	if size, ok := os.LookupEnv(CacheSizeEnv); ok {
+		cacheSize, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", CacheSizeEnv, err)
+		}
+	}
+
+	var remote cache.Backend
+	remoteHTTP, err := cache.NewHTTPFromEnv(Env())
+	if err != nil {
+		return nil, err
+	}
+
+	if remoteHTTP != nil {
+		remote = remoteHTTP
+	}
+
 	return &State{
-		CWD:     cwd,
-		args:    os.Args,
-		Lock:    lock,
-		Context: ctx,
-		Group:   bounded,
+		CWD:      cwd,
+		args:     os.Args,
+		Lock:     lock,
+		Context:  ctx,
+		Group:    bounded,
+		Jobs:     pool,
+		Failures: concurrent.NewSlice[Failure](),
+		Tools:    NewTools(),
+		Cache:    cache.New(cache.NewLocal(filepath.Join(cwd, BakeDirPath, BakeCacheDirname), cacheSize), remote),
+		Events:   event.NewBus(),
 	}, nil
 }
 
+// Fork creates a copy of state with its own group and a fresh lock such that
+// it can be used for a separate run; useful for running the same task multiple times
+func (state State) Fork(ctx context.Context) (*State, error) {
+	bounded, ctx := newGroup(ctx)
+	lock, err := lockFromFilesystem(state.CWD)
+	if err != nil {
+		return nil, err
+	}
+
+	state.Context = ctx
+	state.Group = bounded
+	state.Lock = lock
+	state.Failures = concurrent.NewSlice[Failure]()
+	// tools might have been updated between runs
+	state.Tools = NewTools()
+	return &state, nil
+}
+
+// NewJobs creates a pool that allows n instances to run in parallel; one per cpu if n is 0
+func NewJobs(n int) (*concurrent.Pool, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("the amount of parallel jobs cannot be negative but %d was provided", n)
+	}
+
+	if n == 0 {
+		n = runtime.NumCPU()
+	}
+
+	return concurrent.NewPool(n), nil
+}
+
+// newGroup creates an unbounded group; the parallelism is limited by the
+// jobs pool instead such that spawning goroutines never blocks
+func newGroup(ctx context.Context) (*errgroup.Group, context.Context) {
+	return errgroup.WithContext(ctx)
+}
+
+// WithContext creates a copy of state using ctx for everything it runs
+func (state State) WithContext(ctx context.Context) *State {
+	state.Context = ctx
+	return &state
+}
+
 func (state State) EvalContext() *hcl.EvalContext {
 	args := make([]cty.Value, len(state.args))
 	for index, arg := range state.args {
@@ -64,6 +170,7 @@ func (state State) EvalContext() *hcl.EvalContext {
 			"args": cty.ListVal(args),
 			"env":  cty.MapVal(env),
 		}),
+		schema.VarScope: cty.ObjectVal(state.Variables),
 	}
 
 	ctx := hcl.EvalContext{
@@ -73,21 +180,58 @@ func (state State) EvalContext() *hcl.EvalContext {
 	return ctx.NewChild()
 }
 
+// Targets is false only for the instances of the requested task other than the requested one
+func (state State) Targets(path cty.Path) bool {
+	if state.Instance == nil || !path.HasPrefix(state.Instance[:len(state.Instance)-1]) {
+		return true
+	}
+
+	return path.HasPrefix(state.Instance)
+}
+
+type Failure struct {
+	Path        cty.Path
+	Diagnostics hcl.Diagnostics
+}
+
+// Failed is true if any instance of the address with path failed
+func (state State) Failed(path cty.Path) bool {
+	for _, failure := range state.Failures.Items() {
+		if failure.Path.HasPrefix(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
 type StateFlags struct {
-	Dry   bool
-	Prune bool
-	Force bool
+	Dry       bool
+	Prune     bool
+	Force     bool
+	KeepGoing bool
+	// Output mode of all tasks; overrides their own. Empty if not set
+	Output string
 }
 
-func NewStateFlags(dry, prune, force bool) (StateFlags, error) {
+func NewStateFlags(dry, prune, force, keepGoing bool, output string) (StateFlags, error) {
 	if dry && force {
 		return StateFlags{}, fmt.Errorf(`"dry" and "force" are contradictory flags`)
 	}
 
+	if output != "" && output != OutputJSON {
+		err := event.ValidateMode(output)
+		if err != nil {
+			return StateFlags{}, err
+		}
+	}
+
 	return StateFlags{
-		Dry:   dry,
-		Prune: prune,
-		Force: force,
+		Dry:       dry,
+		Prune:     prune,
+		Force:     force,
+		KeepGoing: keepGoing,
+		Output:    output,
 	}, nil
 }
 
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestNewJobs(t *testing.T) {
+	tests := []struct {
+		name  string
+		jobs  int
+		size  int
+		fails bool
+	}{
+		{name: "explicit", jobs: 2, size: 2},
+		{name: "one per cpu", jobs: 0, size: runtime.NumCPU()},
+		{name: "negative", jobs: -1, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// act
+			pool, err := NewJobs(test.jobs)
+
+			// assert
+			if test.fails {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if pool.Size() != test.size {
+				t.Errorf("expected %d jobs but got %d", test.size, pool.Size())
+			}
+		})
+	}
+}
+
+func TestJobsEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		set   bool
+		size  int
+		fails bool
+	}{
+		{name: "default", size: DefaultParallelism},
+		{name: "explicit", value: "3", set: true, size: 3},
+		{name: "one per cpu", value: "0", set: true, size: runtime.NumCPU()},
+		{name: "not a number", value: "many", set: true, fails: true},
+		{name: "negative", value: "-2", set: true, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			chdir(t, t.TempDir())
+			t.Setenv(JobsEnv, test.value)
+			if !test.set {
+				os.Unsetenv(JobsEnv)
+			}
+
+			// act
+			state, err := NewState(context.Background())
+
+			// assert
+			if test.fails {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if state.Jobs.Size() != test.size {
+				t.Errorf("expected %d jobs but got %d", test.size, state.Jobs.Size())
+			}
+		})
+	}
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(previous)
+	})
+}
+
+func TestTargets(t *testing.T) {
+	build := cty.GetAttrPath("build")
+	tests := []struct {
+		name     string
+		instance cty.Path
+		path     cty.Path
+		want     bool
+	}{
+		{name: "whole task requested", instance: nil, path: build.IndexInt(1), want: true},
+		{name: "requested instance", instance: build.IndexInt(1), path: build.IndexInt(1), want: true},
+		{name: "other instance", instance: build.IndexInt(1), path: build.IndexInt(0), want: false},
+		{name: "requested key", instance: build.IndexString("linux"), path: build.IndexString("linux"), want: true},
+		{name: "other key", instance: build.IndexString("linux"), path: build.IndexString("darwin"), want: false},
+		{name: "other task", instance: build.IndexInt(1), path: cty.GetAttrPath("gen").IndexInt(0), want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			state := State{Instance: test.instance}
+
+			// act
+			got := state.Targets(test.path)
+
+			// assert
+			if got != test.want {
+				t.Errorf("expected %t but got %t", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"sync"
+
+	"bake/internal/promise"
+)
+
+// Tools runs the version probe of external tools (ex: "go version") at most once per
+// run such that all tasks declaring the same tool share its fingerprint
+type Tools struct {
+	mutex  sync.Mutex
+	probes map[string]*promise.Promise[string]
+}
+
+func NewTools() *Tools {
+	return &Tools{probes: map[string]*promise.Promise[string]{}}
+}
+
+// Fingerprint returns the output of the probe identified by key; blocking until it is available.
+// Only the first probe with a given key runs, the others share its result
+func (tools *Tools) Fingerprint(key string, probe func() (string, error)) (string, error) {
+	tools.mutex.Lock()
+	result, ok := tools.probes[key]
+	if !ok {
+		result = promise.New(probe)
+		tools.probes[key] = result
+	}
+	tools.mutex.Unlock()
+
+	return result.Wait()
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+const (
+	// VarEnvPrefix of the env vars that set the value of a variable, ex: BAKE_VAR_name
+	VarEnvPrefix = "BAKE_VAR_"
+	// VarsFileExt of the files that set the value of variables
+	VarsFileExt = ".bakevars"
+	// VarFlag sets the value of a variable from the cli, ex: -var name=value
+	VarFlag = "var"
+)
+
+// VariableValue sets the value of a variable from outside of the recipes
+type VariableValue struct {
+	Name string
+	// Raw value from the cli or an env var; parsed according to the type of the variable
+	Raw string
+	// Expr from a vars file; nil if Raw is used instead
+	Expr hcl.Expression
+	// Source describes where the value comes from, ex: BAKE_VAR_name
+	Source string
+}
+
+// VariablesFromEnv returns the values of the env vars prefixed with VarEnvPrefix
+func VariablesFromEnv(env map[string]string) []VariableValue {
+	result := make([]VariableValue, 0)
+	for key, value := range env {
+		if !strings.HasPrefix(key, VarEnvPrefix) {
+			continue
+		}
+
+		result = append(result, VariableValue{
+			Name:   strings.TrimPrefix(key, VarEnvPrefix),
+			Raw:    value,
+			Source: key,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// VariablesFromFlags parses the name=value pairs passed through the cli
+func VariablesFromFlags(flags []string) ([]VariableValue, error) {
+	result := make([]VariableValue, 0, len(flags))
+	for _, flag := range flags {
+		parts := strings.SplitN(flag, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf(`invalid -%s "%s"; expected name=value`, VarFlag, flag)
+		}
+
+		result = append(result, VariableValue{
+			Name:   parts[0],
+			Raw:    parts[1],
+			Source: "-" + VarFlag,
+		})
+	}
+
+	return result, nil
+}
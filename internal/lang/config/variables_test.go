@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestVariablesFromFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags []string
+		want  []VariableValue
+		fails bool
+	}{
+		{name: "none", flags: nil, want: []VariableValue{}},
+		{name: "pairs", flags: []string{"a=1", "b="}, want: []VariableValue{
+			{Name: "a", Raw: "1", Source: "-var"},
+			{Name: "b", Raw: "", Source: "-var"},
+		}},
+		{name: "equals in value", flags: []string{"query=a=b"}, want: []VariableValue{{Name: "query", Raw: "a=b", Source: "-var"}}},
+		{name: "missing value", flags: []string{"a"}, fails: true},
+		{name: "missing name", flags: []string{"=1"}, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// act
+			got, err := VariablesFromFlags(test.flags)
+
+			// assert
+			if (err != nil) != test.fails {
+				t.Fatalf("expected failure %t but got %v", test.fails, err)
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(test.want) && !test.fails {
+				t.Errorf("expected %v but got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestVariablesFromEnv(t *testing.T) {
+	// arrange
+	env := map[string]string{
+		"BAKE_VAR_b": "2",
+		"BAKE_VAR_a": "1",
+		"HOME":       "/root",
+	}
+
+	// act
+	got := VariablesFromEnv(env)
+
+	// assert
+	want := []VariableValue{
+		{Name: "a", Raw: "1", Source: "BAKE_VAR_a"},
+		{Name: "b", Raw: "2", Source: "BAKE_VAR_b"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+}
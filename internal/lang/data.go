@@ -1,15 +1,13 @@
 package lang
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"os"
-	"os/exec"
-	"strings"
 	"sync"
 	"time"
 
 	"bake/internal/concurrent"
+	"bake/internal/event"
 	"bake/internal/lang/config"
 	"bake/internal/lang/meta"
 	"bake/internal/lang/schema"
@@ -27,15 +25,20 @@ type data struct {
 	filename string
 
 	namedInstances   map[string]*dataInstance // for_each
-	indexedInstances []*dataInstance          // count?
+	indexedInstances []*dataInstance          // count
 	singleInstance   *dataInstance            // plain task
 }
 
 type dataMetadata struct {
 	Block hcl.Range // manual metadata
 	// metadata from block
-	Command hcl.Range
-	Env     hcl.Range
+	Command     hcl.Range
+	Env         hcl.Range
+	Timeout     hcl.Range
+	Workdir     hcl.Range
+	Interpreter hcl.Range
+	// metadata from nested blocks
+	Retry retryMetadata
 }
 
 func newData(raw addressBlock, eval *hcl.EvalContext) (config.Action, hcl.Diagnostics) {
@@ -46,13 +49,42 @@ func newData(raw addressBlock, eval *hcl.EvalContext) (config.Action, hcl.Diagno
 		return nil, diags
 	}
 
+	metadata.Retry, diags = newRetryMetadata(raw.Block.Body, eval)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	count, counted, diags := schema.Count(raw.Block, eval)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	if counted {
+		instances := make([]*dataInstance, 0, count)
+		for index := 0; index < count; index++ {
+			ctx := countContext(index, eval.NewChild())
+			instance, diags := newDataInstance(path.IndexInt(index), raw.module, metadata, raw.Block.Body, ctx)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+
+			instances = append(instances, instance)
+		}
+
+		return &data{
+			path:             path,
+			filename:         metadata.Block.Filename,
+			indexedInstances: instances,
+		}, nil
+	}
+
 	forEachEntries, diags := schema.ForEachEntries(raw.Block, eval)
 	if diags.HasErrors() {
 		return nil, diags
 	}
 
 	if len(forEachEntries) == 0 {
-		instance, diags := newDataInstance(path, metadata, raw.Block.Body, eval)
+		instance, diags := newDataInstance(path, raw.module, metadata, raw.Block.Body, eval)
 		if diags.HasErrors() {
 			return nil, diags
 		}
@@ -67,7 +99,7 @@ func newData(raw addressBlock, eval *hcl.EvalContext) (config.Action, hcl.Diagno
 	instances := map[string]*dataInstance{}
 	for key, value := range forEachEntries {
 		ctx := eachContext(key, value, eval.NewChild())
-		instance, diags := newDataInstance(path.IndexString(key), metadata, raw.Block.Body, ctx)
+		instance, diags := newDataInstance(path.IndexString(key), raw.module, metadata, raw.Block.Body, ctx)
 		if diags.HasErrors() {
 			return nil, diags
 		}
@@ -100,13 +132,13 @@ func (d data) CTY() cty.Value {
 		return cty.MapVal(m)
 	}
 
-	if len(d.indexedInstances) > 0 {
+	if d.indexedInstances != nil {
 		m := make([]cty.Value, len(d.indexedInstances))
 		for index, instance := range d.indexedInstances {
 			m[index] = instance.CTY()
 		}
 
-		return cty.ListVal(m)
+		return cty.TupleVal(m)
 	}
 
 	return d.singleInstance.CTY()
@@ -121,7 +153,7 @@ func (d *data) Apply(state *config.State) *sync.WaitGroup {
 		return applyIndexed(maps.Values(d.namedInstances), state)
 	}
 
-	if len(d.indexedInstances) > 0 {
+	if d.indexedInstances != nil {
 		return applyIndexed(d.indexedInstances, state)
 	}
 
@@ -131,32 +163,70 @@ func (d *data) Apply(state *config.State) *sync.WaitGroup {
 type dataInstance struct {
 	path     cty.Path
 	metadata dataMetadata
-
-	Command  string            `hcl:"command,optional"`
-	Env      map[string]string `hcl:"env,optional"`
-	Remain   hcl.Body          `hcl:",remain"`
-	StdOut   values.EventualString
-	StdErr   values.EventualString
-	ExitCode values.EventualInt64
+	// directory where the command runs; relative to the root recipes. See Workdir
+	dir string
+	// see Command and Interpreter
+	cmd command
+
+	Command     cty.Value         `hcl:"command,optional"`
+	Interpreter []string          `hcl:"interpreter,optional"`
+	Env         map[string]string `hcl:"env,optional"`
+	Timeout     string            `hcl:"timeout,optional"`
+	Workdir     string            `hcl:"workdir,optional"`
+	Retry       *Retry            `hcl:"retry,block"`
+	Remain      hcl.Body          `hcl:",remain"`
+	StdOut      values.EventualString
+	StdErr      values.EventualString
+	ExitCode    values.EventualInt64
+	timeout     time.Duration
 }
 
-func newDataInstance(path cty.Path, metadata dataMetadata, body hcl.Body, eval *hcl.EvalContext) (*dataInstance, hcl.Diagnostics) {
+func newDataInstance(path cty.Path, module *Module, metadata dataMetadata, body hcl.Body, eval *hcl.EvalContext) (*dataInstance, hcl.Diagnostics) {
 	data := &dataInstance{path: path, metadata: metadata}
 	diags := gohcl.DecodeBody(body, eval, data)
 	if diags.HasErrors() {
 		return nil, diags
 	}
 
+	data.dir, diags = workdir(module.root, module.Dir, data.Workdir, &metadata.Workdir, &metadata.Block)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	data.cmd, diags = newCommand(data.Command, data.Interpreter, module, &metadata.Command, &metadata.Interpreter, &metadata.Block)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	// keep the same value as if it was an empty string
+	if data.Command.IsNull() {
+		data.Command = cty.StringVal("")
+	}
+
 	diags = schema.ValidateAttributes(data.Remain)
 	if diags.HasErrors() {
 		return nil, diags
 	}
 
+	data.timeout, diags = parseDuration("timeout", data.Timeout, &metadata.Timeout, &metadata.Block)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	diags = data.Retry.validate(metadata.Retry)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
 	// overwrite default env with custom values
 	data.Env = concurrent.Merge(config.Env(), data.Env)
 	return data, nil
 }
 
+func (d dataInstance) GetPath() cty.Path {
+	return d.path
+}
+
 func (d dataInstance) CTY() cty.Value {
 	return values.StructToCty(d)
 }
@@ -166,60 +236,52 @@ func (d *dataInstance) Apply(state *config.State) hcl.Diagnostics {
 		return nil
 	}
 
-	log := NewLogger(d.path)
-	log.Println(`refreshing ...`)
-	// which shell should I use?
-	terminal := "bash"
-	shell, ok := os.LookupEnv("SHELL")
-	if ok {
-		terminal = shell
-	}
-
-	// use shell with fail fast flags
-	script := fmt.Sprintf(`
-	set -euo pipefail
-
-	%s`, d.Command)
-	command := exec.CommandContext(state.Context, terminal, "-c", script)
-	command.Env = config.EnvSlice(d.Env)
-	// todo: should I allow configuring these?
-	var stdout, stderr bytes.Buffer
-	command.Stdout = &stdout
-	command.Stderr = &stderr
-	start := time.Now()
-	err := command.Run()
-	end := time.Now()
+	log := state.Events.Logger(paths.String(d.path))
+	log.Planned(true, `refreshing ...`)
+	return d.Retry.do(state.Context, log, func() (int64, hcl.Diagnostics) {
+		diags := d.run(state.Context, log)
+		return d.ExitCode.Int64, diags
+	})
+}
+
+func (d *dataInstance) run(ctx context.Context, log *event.Logger) hcl.Diagnostics {
+	// stdout is the value of the data so its output is only shown on failure
+	result := d.cmd.run(ctx, log, event.Quiet, d.dir, d.Env, d.timeout)
 	// store results
 	d.StdOut = values.EventualString{
-		String: strings.TrimSpace(stdout.String()),
+		String: result.stdout,
 		Valid:  true,
 	}
 
 	d.StdErr = values.EventualString{
-		String: strings.TrimSpace(stderr.String()),
+		String: result.stderr,
 		Valid:  true,
 	}
 
 	d.ExitCode = values.EventualInt64{
-		Int64: int64(command.ProcessState.ExitCode()),
+		Int64: result.exitCode,
 		Valid: true,
 	}
 
-	detail := d.StdErr.String
-	if detail == "" {
-		detail = d.StdOut.String
+	if result.timedOut {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`"%s" command timed out after %s`, paths.String(d.path), d.timeout),
+			Detail:   result.detail(),
+			Subject:  &d.metadata.Timeout,
+			Context:  &d.metadata.Block,
+		}}
 	}
 
-	if err != nil {
+	if result.err != nil {
 		return hcl.Diagnostics{{
 			Severity: hcl.DiagError,
-			Summary:  fmt.Sprintf(`"%s" command failed with: %s`, paths.String(d.path), command.ProcessState.String()),
-			Detail:   detail,
+			Summary:  fmt.Sprintf(`"%s" command failed with: %s`, paths.String(d.path), result.state),
+			Detail:   result.detail(),
 			Subject:  &d.metadata.Command,
 			Context:  &d.metadata.Block,
 		}}
 	}
 
-	log.Println(`done in ` + end.Sub(start).String())
 	return nil
 }
@@ -4,12 +4,8 @@ import (
 	"bake/internal/lang/config"
 	"bake/internal/lang/schema"
 	"bake/internal/paths"
-	"log"
-	"os"
 
 	"github.com/hashicorp/hcl/v2/gohcl"
-	"github.com/mitchellh/colorstring"
-	"github.com/zclconf/go-cty/cty"
 )
 
 type CliCommand struct{ Name, Description string }
@@ -27,7 +23,7 @@ func FilterPublicTasks(addrs []config.RawAddress) []CliCommand {
 			continue
 		}
 
-		attrs, diags := block.Block.Body.JustAttributes()
+		attrs, diags := schema.Attributes(block.Block.Body)
 		if diags.HasErrors() {
 			continue
 		}
@@ -48,9 +44,3 @@ func FilterPublicTasks(addrs []config.RawAddress) []CliCommand {
 
 	return commands
 }
-
-func NewLogger(path cty.Path) *log.Logger {
-	prefix := colorstring.Color("[bold]" + paths.String(path))
-	// todo: change stdout according to state
-	return log.New(os.Stdout, prefix+": ", 0)
-}
@@ -10,9 +10,10 @@ import (
 )
 
 type Local struct {
-	name  string
-	expr  hcl.Expression
-	value cty.Value
+	name   string
+	expr   hcl.Expression
+	value  cty.Value
+	module *Module
 }
 
 func (local Local) GetFilename() string {
@@ -20,16 +21,16 @@ func (local Local) GetFilename() string {
 }
 
 func (local Local) GetPath() cty.Path {
-	return cty.GetAttrPath(schema.LocalScope).GetAttr(local.name)
+	return local.module.prefix(cty.GetAttrPath(schema.LocalScope).GetAttr(local.name))
 }
 
 func (local Local) Dependencies() ([]hcl.Traversal, hcl.Diagnostics) {
-	return local.expr.Variables(), nil
+	return local.module.traversals(local.expr.Variables()), nil
 }
 
 func (local Local) Decode(ctx *hcl.EvalContext) (config.Action, hcl.Diagnostics) {
 	newLocal := local
-	value, diagnostics := local.expr.Value(ctx)
+	value, diagnostics := local.expr.Value(local.module.evalContext(ctx))
 	if diagnostics.HasErrors() {
 		return nil, diagnostics
 	}
@@ -1,6 +1,7 @@
 package meta
 
 import (
+	"bake/internal/lang/schema"
 	"bake/internal/util"
 	"fmt"
 	"reflect"
@@ -34,7 +35,8 @@ func decodeBodyToValue(body hcl.Body, ctx *hcl.EvalContext, val reflect.Value) h
 }
 
 func decodeBodyToStruct(body hcl.Body, ctx *hcl.EvalContext, val reflect.Value) hcl.Diagnostics {
-	attrs, diags := body.JustAttributes()
+	// nested blocks have their own metadata
+	attrs, diags := schema.Attributes(body)
 	if diags.HasErrors() {
 		return diags
 	}
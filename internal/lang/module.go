@@ -0,0 +1,202 @@
+package lang
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bake/internal/lang/schema"
+	"bake/internal/paths"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Module is a directory whose recipes are loaded under a namespace, ex: module.api.build.
+// The recipes of a module refer to their own tasks, data and locals as if they were the
+// root recipes; the root recipes refer to them through module.<name>
+type Module struct {
+	Name string
+	// Dir is relative to the root recipes; commands of the module run in it
+	Dir string
+	// root is the absolute directory of the root recipes; see config.State.CWD
+	root   string
+	path   cty.Path
+	source hcl.Range
+	parent *Module
+	// default interpreter of the tasks and data of the module; inherited from its parent
+	interpreter      []string
+	interpreterRange *hcl.Range
+}
+
+// NewRootModule are the recipes of root; the directory where bake runs
+func NewRootModule(root string) *Module {
+	return &Module{root: root}
+}
+
+// NewModule decodes a module block found in the recipes of parent
+func NewModule(block *hcl.Block, parent *Module) (*Module, hcl.Diagnostics) {
+	content, diags := block.Body.Content(schema.ModuleSchema())
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	attr := content.Attributes[schema.SourceAttr]
+	var source string
+	diags = gohcl.DecodeExpression(attr.Expr, nil, &source)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	name := block.Labels[0]
+	module := &Module{
+		Name: name,
+		// the source is relative to the recipe declaring the module
+		Dir:    filepath.Join(filepath.Dir(block.DefRange.Filename), source),
+		root:   parent.root,
+		path:   parent.GetPath().GetAttr(schema.ModuleLabel).GetAttr(name),
+		source: attr.Expr.Range(),
+		parent: parent,
+	}
+
+	if filepath.IsAbs(source) || module.Dir == ".." || strings.HasPrefix(module.Dir, ".."+string(filepath.Separator)) {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`module "%s" must be inside of the root recipes directory`, name),
+			Subject:  &module.source,
+			Context:  &block.DefRange,
+		}}
+	}
+
+	info, err := os.Stat(filepath.Join(module.root, module.Dir))
+	if err == nil && !info.IsDir() {
+		err = fmt.Errorf("%s is not a directory", module.Dir)
+	}
+
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`couldn't read module "%s"`, name),
+			Detail:   err.Error(),
+			Subject:  &module.source,
+			Context:  &block.DefRange,
+		}}
+	}
+
+	return module, nil
+}
+
+// GetPath is the namespace of the module; empty for the root recipes
+func (module *Module) GetPath() cty.Path {
+	return module.path
+}
+
+func (module *Module) IsRoot() bool {
+	return module.parent == nil
+}
+
+// SetInterpreter declares the default interpreter of the tasks and data of the module
+func (module *Module) SetInterpreter(attr *hcl.Attribute) hcl.Diagnostics {
+	if module.interpreterRange != nil {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`"%s" was already declared at %s`, schema.InterpreterAttr, module.interpreterRange.String()),
+			Subject:  &attr.Range,
+		}}
+	}
+
+	var interpreter []string
+	diags := gohcl.DecodeExpression(attr.Expr, nil, &interpreter)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	if len(interpreter) == 0 {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`"%s" must contain at least the program to run, ex: ["python3", "-c"]`, schema.InterpreterAttr),
+			Subject:  &attr.Range,
+		}}
+	}
+
+	module.interpreter = interpreter
+	module.interpreterRange = &attr.Range
+	return nil
+}
+
+// defaultInterpreter of the module; nil if neither it nor any of its parents declared one
+func (module *Module) defaultInterpreter() []string {
+	for current := module; current != nil; current = current.parent {
+		if current.interpreter != nil {
+			return current.interpreter
+		}
+	}
+
+	return nil
+}
+
+// prefix the path with the namespace of the module
+func (module *Module) prefix(path cty.Path) cty.Path {
+	result := make(cty.Path, 0, len(module.GetPath())+len(path))
+	result = append(result, module.GetPath()...)
+	return append(result, path...)
+}
+
+// traversals rewrites the references found in the recipes of the module such that they
+// point to the namespace of the module, ex: data.version -> module.api.data.version.
+// References to values injected by bake are kept as they are
+func (module *Module) traversals(traversals []hcl.Traversal) []hcl.Traversal {
+	if module.IsRoot() {
+		return traversals
+	}
+
+	result := make([]hcl.Traversal, 0, len(traversals))
+	for _, traversal := range traversals {
+		if schema.IsIgnoredPrefix(paths.FromTraversal(traversal)) {
+			result = append(result, traversal)
+			continue
+		}
+
+		root := traversal[0].(hcl.TraverseRoot)
+		prefixed := hcl.Traversal{hcl.TraverseRoot{Name: schema.ModuleLabel, SrcRange: root.SrcRange}}
+		for _, step := range module.path[1:] {
+			prefixed = append(prefixed, hcl.TraverseAttr{Name: step.(cty.GetAttrStep).Name, SrcRange: root.SrcRange})
+		}
+
+		prefixed = append(prefixed, hcl.TraverseAttr{Name: root.Name, SrcRange: root.SrcRange})
+		result = append(result, append(prefixed, traversal[1:]...))
+	}
+
+	return result
+}
+
+// evalContext scopes ctx to the values of the module such that its recipes can refer
+// to them as if they were the root recipes
+func (module *Module) evalContext(ctx *hcl.EvalContext) *hcl.EvalContext {
+	if module.IsRoot() {
+		return ctx
+	}
+
+	variables := ctx.Variables
+	for index := 1; index < len(module.path); index += 2 {
+		name := module.path[index].(cty.GetAttrStep).Name
+		modules, ok := variables[schema.ModuleLabel]
+		if !ok || !modules.Type().IsObjectType() || !modules.Type().HasAttribute(name) {
+			variables = map[string]cty.Value{}
+			break
+		}
+
+		variables = modules.GetAttr(name).AsValueMap()
+	}
+
+	scoped := map[string]cty.Value{}
+	for name, value := range variables {
+		scoped[name] = value
+	}
+
+	scoped[schema.PathScope] = ctx.Variables[schema.PathScope]
+	ctx.Variables = scoped
+	return ctx
+}
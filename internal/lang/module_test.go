@@ -0,0 +1,118 @@
+package lang
+
+import (
+	"testing"
+
+	"bake/internal/lang/schema"
+	"bake/internal/paths"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// testModules returns the root recipes together with module.api and module.api.module.db
+func testModules() (*Module, *Module, *Module) {
+	root := NewRootModule("")
+	api := &Module{Name: "api", path: root.GetPath().GetAttr(schema.ModuleLabel).GetAttr("api"), parent: root}
+	db := &Module{Name: "db", path: api.GetPath().GetAttr(schema.ModuleLabel).GetAttr("db"), parent: api}
+	return root, api, db
+}
+
+func TestModuleTraversals(t *testing.T) {
+	root, api, db := testModules()
+	tests := []struct {
+		name      string
+		module    *Module
+		traversal string
+		want      string
+	}{
+		{name: "root task", module: root, traversal: "build", want: "build"},
+		{name: "root data", module: root, traversal: "data.version.std_out", want: "data.version.std_out"},
+		{name: "task", module: api, traversal: "build", want: "module.api.build"},
+		{name: "instance", module: api, traversal: "gen[1]", want: "module.api.gen[1]"},
+		{name: "data", module: api, traversal: "data.version.std_out", want: "module.api.data.version.std_out"},
+		{name: "local", module: api, traversal: "local.name", want: "module.api.local.name"},
+		{name: "nested module", module: db, traversal: "build", want: "module.api.module.db.build"},
+		{name: "module of a module", module: api, traversal: "module.db.build", want: "module.api.module.db.build"},
+		{name: "variable", module: api, traversal: "var.name", want: "var.name"},
+		{name: "path", module: db, traversal: "path.root", want: "path.root"},
+		{name: "count", module: api, traversal: "count.index", want: "count.index"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			traversal, diags := hclsyntax.ParseTraversalAbs([]byte(test.traversal), "main.hcl", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			// act
+			got := test.module.traversals([]hcl.Traversal{traversal})
+
+			// assert
+			if len(got) != 1 {
+				t.Fatalf("expected 1 traversal but got %d", len(got))
+			}
+
+			if paths.String(paths.FromTraversal(got[0])) != test.want {
+				t.Errorf(`expected "%s" but got "%s"`, test.want, paths.String(paths.FromTraversal(got[0])))
+			}
+		})
+	}
+}
+
+func TestModuleEvalContext(t *testing.T) {
+	root, api, db := testModules()
+	variables := func() map[string]cty.Value {
+		return map[string]cty.Value{
+			"build":          cty.StringVal("root"),
+			schema.PathScope: cty.ObjectVal(map[string]cty.Value{"root": cty.StringVal("/repo")}),
+			schema.ModuleLabel: cty.ObjectVal(map[string]cty.Value{
+				"api": cty.ObjectVal(map[string]cty.Value{
+					"build": cty.StringVal("api"),
+					schema.ModuleLabel: cty.ObjectVal(map[string]cty.Value{
+						"db": cty.ObjectVal(map[string]cty.Value{"build": cty.StringVal("db")}),
+					}),
+				}),
+			}),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		module  *Module
+		want    cty.Value
+		missing bool
+	}{
+		{name: "root", module: root, want: cty.StringVal("root")},
+		{name: "module", module: api, want: cty.StringVal("api")},
+		{name: "nested module", module: db, want: cty.StringVal("db")},
+		{name: "module without values", module: &Module{Name: "web", path: cty.GetAttrPath(schema.ModuleLabel).GetAttr("web"), parent: root}, missing: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			ctx := &hcl.EvalContext{Variables: variables()}
+
+			// act
+			scoped := test.module.evalContext(ctx)
+
+			// assert
+			got, ok := scoped.Variables["build"]
+			if test.missing {
+				if ok {
+					t.Errorf("expected no build but got %#v", got)
+				}
+			} else if !ok || !got.Equals(test.want).True() {
+				t.Errorf("expected build = %#v but got %#v", test.want, got)
+			}
+
+			if _, ok := scoped.Variables[schema.PathScope]; !ok {
+				t.Errorf("expected path to be available to every module")
+			}
+		})
+	}
+}
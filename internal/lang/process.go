@@ -0,0 +1,127 @@
+package lang
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// KillGracePeriod is the time that processes have to exit after being asked
+// to terminate; before being killed
+const KillGracePeriod = 5 * time.Second
+
+// runProcess starts the command in its own process group and waits for it to finish.
+// Once ctx is done the whole group is asked to terminate and killed after KillGracePeriod,
+// such that no grandchild process (ex: those started by the shell) is left behind
+func runProcess(ctx context.Context, command *exec.Cmd) error {
+	setProcessGroup(command)
+	err := command.Start()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+
+		terminate(command)
+		select {
+		case <-done:
+		case <-time.After(KillGracePeriod):
+			kill(command)
+		}
+	}()
+
+	err = command.Wait()
+	close(done)
+	return err
+}
+
+// parseDuration of an attribute like timeout or backoff; zero if it was not set
+func parseDuration(name, value string, subject, context *hcl.Range) (time.Duration, hcl.Diagnostics) {
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		detail := `a positive duration like "30s" or "5m" is expected`
+		if err != nil {
+			detail = err.Error()
+		}
+
+		return 0, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`invalid %s "%s"`, name, value),
+			Detail:   detail,
+			Subject:  subject,
+			Context:  context,
+		}}
+	}
+
+	return duration, nil
+}
+
+// workdir resolves the workdir attribute against dir; the directory of the recipes declaring it
+// relative to root. The result is relative to root such that files are always stored by the same
+// paths on the lock file; empty for the root recipes directory
+func workdir(root, dir, value string, subject, context *hcl.Range) (string, hcl.Diagnostics) {
+	if value == "" {
+		return dir, nil
+	}
+
+	result := filepath.Join(dir, value)
+	if filepath.IsAbs(value) {
+		var err error
+		result, err = filepath.Rel(root, value)
+		if err != nil {
+			return "", hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf(`invalid workdir "%s"`, value),
+				Detail:   err.Error(),
+				Subject:  subject,
+				Context:  context,
+			}}
+		}
+	}
+
+	if result == ".." || strings.HasPrefix(result, ".."+string(filepath.Separator)) {
+		return "", hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`workdir "%s" must be inside of the root recipes directory`, value),
+			Subject:  subject,
+			Context:  context,
+		}}
+	}
+
+	info, err := os.Stat(filepath.Join(root, result))
+	if err == nil && !info.IsDir() {
+		err = fmt.Errorf("%s is not a directory", result)
+	}
+
+	if err != nil {
+		return "", hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`workdir "%s" doesn't exist`, value),
+			Detail:   err.Error(),
+			Subject:  subject,
+			Context:  context,
+		}}
+	}
+
+	if result == "." {
+		return "", nil
+	}
+
+	return result, nil
+}
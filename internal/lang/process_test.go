@@ -0,0 +1,69 @@
+package lang
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkdir(t *testing.T) {
+	// the root recipes are not in the working directory of the process
+	root := t.TempDir()
+	err := os.Mkdir(filepath.Join(root, "sub"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(root, "file.txt"), nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		value   string
+		want    string
+		summary string
+		detail  string
+	}{
+		{name: "not set", dir: "sub", value: "", want: "sub"},
+		{name: "relative", dir: "", value: "sub", want: "sub"},
+		{name: "relative to module", dir: "sub", value: "..", want: ""},
+		{name: "root", dir: "", value: ".", want: ""},
+		{name: "absolute", dir: "", value: filepath.Join(root, "sub"), want: "sub"},
+		{name: "absolute root", dir: "sub", value: root, want: ""},
+		{name: "outside root", dir: "", value: "..", summary: `workdir ".." must be inside of the root recipes directory`},
+		{name: "absolute outside root", dir: "", value: filepath.Dir(root), summary: `workdir "` + filepath.Dir(root) + `" must be inside of the root recipes directory`},
+		{name: "missing", dir: "", value: "missing", summary: `workdir "missing" doesn't exist`},
+		{name: "not a directory", dir: "", value: "file.txt", summary: `workdir "file.txt" doesn't exist`, detail: "file.txt is not a directory"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// act
+			got, diags := workdir(root, test.dir, test.value, nil, nil)
+
+			// assert
+			if test.summary == "" {
+				if diags.HasErrors() {
+					t.Fatal(diags)
+				}
+
+				if got != test.want {
+					t.Errorf(`expected "%s" but got "%s"`, test.want, got)
+				}
+
+				return
+			}
+
+			if !diags.HasErrors() || diags[0].Summary != test.summary {
+				t.Fatalf(`expected "%s" but got %s`, test.summary, diags)
+			}
+
+			if test.detail != "" && diags[0].Detail != test.detail {
+				t.Errorf(`expected "%s" but got "%s"`, test.detail, diags[0].Detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package lang
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(command *exec.Cmd) {
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminate sends SIGTERM to the whole process group
+func terminate(command *exec.Cmd) {
+	_ = syscall.Kill(-command.Process.Pid, syscall.SIGTERM)
+}
+
+// kill sends SIGKILL to the whole process group
+func kill(command *exec.Cmd) {
+	_ = syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,64 @@
+//go:build !windows
+
+package lang
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunProcessTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		fails   bool
+		created string
+		missing string
+	}{
+		{name: "finishes in time", script: "echo done > done.txt", created: "done.txt"},
+		// the grandchild would write the file after the timeout unless the whole group is stopped
+		{name: "grandchild is stopped", script: "(sleep 0.5 && echo late > late.txt) & wait", fails: true, missing: "late.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			dir := t.TempDir()
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			command := exec.Command("sh", "-c", test.script)
+			command.Dir = dir
+
+			// act
+			start := time.Now()
+			err := runProcess(ctx, command)
+			duration := time.Since(start)
+
+			// assert
+			if (err != nil) != test.fails {
+				t.Errorf("expected failure %t but got %v", test.fails, err)
+			}
+
+			if duration >= KillGracePeriod {
+				t.Errorf("expected the process to stop before the grace period but took %s", duration)
+			}
+
+			time.Sleep(time.Second)
+			if test.created != "" {
+				if _, err := os.Stat(filepath.Join(dir, test.created)); err != nil {
+					t.Errorf(`expected "%s" to be created: %v`, test.created, err)
+				}
+			}
+
+			if test.missing != "" {
+				if _, err := os.Stat(filepath.Join(dir, test.missing)); err == nil {
+					t.Errorf(`expected "%s" to not be created`, test.missing)
+				}
+			}
+		})
+	}
+}
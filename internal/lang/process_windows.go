@@ -0,0 +1,20 @@
+//go:build windows
+
+package lang
+
+import (
+	"os/exec"
+)
+
+// windows has no process groups that can be signaled; only the
+// direct child process is handled
+
+func setProcessGroup(command *exec.Cmd) {}
+
+func terminate(command *exec.Cmd) {
+	_ = command.Process.Kill()
+}
+
+func kill(command *exec.Cmd) {
+	_ = command.Process.Kill()
+}
@@ -0,0 +1,153 @@
+package lang
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"bake/internal/concurrent"
+	"bake/internal/event"
+	"bake/internal/lang/meta"
+	"bake/internal/lang/schema"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// MaxBackoff is the longest wait between attempts; no matter how many were made
+const MaxBackoff = 5 * time.Minute
+
+// Retry policy of a task or data command. A failed command is run again up to
+// Attempts times in total; waiting Backoff before the first retry and doubling
+// it afterwards up to MaxBackoff. If ExitCodes is set, only those exit codes are retried
+type Retry struct {
+	Attempts  int     `hcl:"attempts"`
+	Backoff   string  `hcl:"backoff,optional"`
+	ExitCodes []int64 `hcl:"exit_codes,optional"`
+	backoff   time.Duration
+}
+
+type retryMetadata struct {
+	Block     hcl.Range
+	Attempts  hcl.Range
+	Backoff   hcl.Range
+	ExitCodes hcl.Range
+}
+
+// newRetryMetadata from the retry block nested in body; if any
+func newRetryMetadata(body hcl.Body, eval *hcl.EvalContext) (retryMetadata, hcl.Diagnostics) {
+	blocks, diags := schema.NestedBlocks(body)
+	if diags.HasErrors() {
+		return retryMetadata{}, diags
+	}
+
+	for _, block := range blocks {
+		if block.Type != schema.RetryLabel {
+			continue
+		}
+
+		metadata := retryMetadata{Block: block.DefRange}
+		diags = meta.DecodeRange(block.Body, eval, &metadata)
+		return metadata, diags
+	}
+
+	return retryMetadata{}, nil
+}
+
+func (retry *Retry) validate(metadata retryMetadata) hcl.Diagnostics {
+	if retry == nil {
+		return nil
+	}
+
+	if retry.Attempts < 1 {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`invalid attempts %d`, retry.Attempts),
+			Detail:   "at least 1 attempt is expected",
+			Subject:  &metadata.Attempts,
+			Context:  &metadata.Block,
+		}}
+	}
+
+	var diags hcl.Diagnostics
+	retry.backoff, diags = parseDuration("backoff", retry.Backoff, &metadata.Backoff, &metadata.Block)
+	return diags
+}
+
+// do runs attempt until it succeeds, the policy gives up or ctx is done. The
+// diagnostics of the last attempt include the output of all previous ones. The
+// job slot carried by ctx is handed back while waiting between attempts
+func (retry *Retry) do(ctx context.Context, log *event.Logger, attempt func() (int64, hcl.Diagnostics)) hcl.Diagnostics {
+	failures := make([]hcl.Diagnostics, 0)
+	backoff := time.Duration(0)
+	for number := 1; ; number++ {
+		exitCode, diags := attempt()
+		if !diags.HasErrors() {
+			return diags
+		}
+
+		failures = append(failures, diags)
+		if !retry.retryable(number, exitCode) || ctx.Err() != nil {
+			return attemptsDiagnostics(failures)
+		}
+
+		backoff = retry.next(backoff)
+		log.Printf("attempt %d/%d failed with exit code %d; retrying in %s", number, retry.Attempts, exitCode, backoff)
+		err := concurrent.Sleep(ctx, backoff)
+		if err != nil {
+			return attemptsDiagnostics(failures)
+		}
+	}
+}
+
+// next backoff after previous; the first one is zero
+func (retry *Retry) next(previous time.Duration) time.Duration {
+	backoff := retry.backoff
+	if previous > 0 {
+		backoff = previous * 2
+	}
+
+	if backoff > MaxBackoff {
+		return MaxBackoff
+	}
+
+	return backoff
+}
+
+func (retry *Retry) retryable(attempt int, exitCode int64) bool {
+	if retry == nil || attempt >= retry.Attempts || exitCode == 0 {
+		return false
+	}
+
+	if len(retry.ExitCodes) == 0 {
+		return true
+	}
+
+	for _, code := range retry.ExitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// attemptsDiagnostics reports the last failure along with the output of every attempt
+func attemptsDiagnostics(failures []hcl.Diagnostics) hcl.Diagnostics {
+	last := failures[len(failures)-1]
+	if len(failures) == 1 {
+		return last
+	}
+
+	details := make([]string, 0)
+	for index, diags := range failures {
+		for _, diag := range diags {
+			details = append(details, fmt.Sprintf("attempt %d: %s\n%s", index+1, diag.Summary, diag.Detail))
+		}
+	}
+
+	diagnostic := *last[0]
+	diagnostic.Summary = fmt.Sprintf("%s after %d attempts", diagnostic.Summary, len(failures))
+	diagnostic.Detail = strings.Join(details, "\n\n")
+	return hcl.Diagnostics{&diagnostic}
+}
@@ -0,0 +1,120 @@
+package lang
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"bake/internal/event"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+func TestRetryDo(t *testing.T) {
+	tests := []struct {
+		name      string
+		retry     *Retry
+		exitCodes []int64
+		attempts  int
+		summary   string
+	}{
+		{name: "no policy", retry: nil, exitCodes: []int64{1, 0}, attempts: 1, summary: "failed"},
+		{name: "succeeds on retry", retry: &Retry{Attempts: 3}, exitCodes: []int64{1, 0}, attempts: 2},
+		{name: "gives up", retry: &Retry{Attempts: 2}, exitCodes: []int64{1, 1, 0}, attempts: 2, summary: "failed after 2 attempts"},
+		{name: "retryable exit code", retry: &Retry{Attempts: 3, ExitCodes: []int64{75}}, exitCodes: []int64{75, 0}, attempts: 2},
+		{name: "other exit code", retry: &Retry{Attempts: 3, ExitCodes: []int64{75}}, exitCodes: []int64{1, 0}, attempts: 1, summary: "failed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			if test.retry != nil {
+				test.retry.backoff = time.Millisecond
+			}
+
+			attempts := 0
+			attempt := func() (int64, hcl.Diagnostics) {
+				exitCode := test.exitCodes[attempts]
+				attempts++
+				if exitCode == 0 {
+					return 0, nil
+				}
+
+				return exitCode, hcl.Diagnostics{{Severity: hcl.DiagError, Summary: "failed"}}
+			}
+
+			// act
+			diags := test.retry.do(context.Background(), event.NewBus().Logger("task"), attempt)
+
+			// assert
+			if attempts != test.attempts {
+				t.Errorf("expected %d attempts but got %d", test.attempts, attempts)
+			}
+
+			if test.summary == "" {
+				if diags.HasErrors() {
+					t.Errorf("unexpected diagnostics %s", diags)
+				}
+
+				return
+			}
+
+			if !diags.HasErrors() || diags[0].Summary != test.summary {
+				t.Errorf(`expected "%s" but got %s`, test.summary, diags)
+			}
+		})
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	// arrange
+	retry := &Retry{Attempts: 3, backoff: time.Minute}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	attempts := 0
+
+	// act
+	diags := retry.do(ctx, event.NewBus().Logger("task"), func() (int64, hcl.Diagnostics) {
+		attempts++
+		return 1, hcl.Diagnostics{{Severity: hcl.DiagError, Summary: "failed", Detail: "output"}}
+	})
+
+	// assert
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt but got %d", attempts)
+	}
+
+	if !diags.HasErrors() || !strings.Contains(diags[0].Detail, "output") {
+		t.Errorf("expected the failure of the attempt but got %s", diags)
+	}
+}
+
+func TestRetryNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		backoff  time.Duration
+		previous time.Duration
+		want     time.Duration
+	}{
+		{name: "first", backoff: time.Second, previous: 0, want: time.Second},
+		{name: "doubled", backoff: time.Second, previous: 2 * time.Second, want: 4 * time.Second},
+		{name: "capped", backoff: time.Second, previous: 4 * time.Minute, want: MaxBackoff},
+		{name: "first capped", backoff: time.Hour, previous: 0, want: MaxBackoff},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			retry := &Retry{Attempts: 2, backoff: test.backoff}
+
+			// act
+			got := retry.next(test.previous)
+
+			// assert
+			if got != test.want {
+				t.Errorf("expected %s but got %s", test.want, got)
+			}
+		})
+	}
+}
@@ -5,13 +5,92 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/convert"
 	"github.com/zclconf/go-cty/cty/gocty"
 )
 
+// Attributes of a task or data block body without its nested blocks
+func Attributes(body hcl.Body) (hcl.Attributes, hcl.Diagnostics) {
+	syntax, ok := body.(*hclsyntax.Body)
+	if !ok {
+		return body.JustAttributes()
+	}
+
+	for _, block := range syntax.Blocks {
+		if isNested(block.Type) {
+			continue
+		}
+
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`Unexpected "%s" block`, block.Type),
+			Detail:   "Blocks are not allowed here.",
+			Subject:  &block.TypeRange,
+		}}
+	}
+
+	// JustAttributes rejects any block; even those that are part of the schema
+	attributes := *syntax
+	attributes.Blocks = nil
+	return attributes.JustAttributes()
+}
+
+func isNested(blockType string) bool {
+	for _, block := range NestedSchema().Blocks {
+		if block.Type == blockType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NestedBlocks of a task or data block body
+func NestedBlocks(body hcl.Body) (hcl.Blocks, hcl.Diagnostics) {
+	content, _, diags := body.PartialContent(NestedSchema())
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return content.Blocks, nil
+}
+
+// Variables referenced by the attributes of a task or data block body; including
+// those of its nested blocks
+func Variables(body hcl.Body) ([]hcl.Traversal, hcl.Diagnostics) {
+	attributes, diags := Attributes(body)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	blocks, diags := NestedBlocks(body)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	variables := make([]hcl.Traversal, 0)
+	for _, attribute := range attributes {
+		variables = append(variables, attribute.Expr.Variables()...)
+	}
+
+	for _, block := range blocks {
+		nested, diags := block.Body.JustAttributes()
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		for _, attribute := range nested {
+			variables = append(variables, attribute.Expr.Variables()...)
+		}
+	}
+
+	return variables, nil
+}
+
 func GetRangeFor(block *hcl.Block, name string) *hcl.Range {
-	attributes, diagnostics := block.Body.JustAttributes()
+	attributes, diagnostics := Attributes(block.Body)
 	if diagnostics.HasErrors() {
 		return nil
 	}
@@ -41,7 +120,7 @@ func TupleOfReferences(attr *hcl.Attribute) ([]hcl.Traversal, hcl.Diagnostics) {
 }
 
 func ForEachEntries(block *hcl.Block, ctx *hcl.EvalContext) (map[string]string, hcl.Diagnostics) {
-	attributes, diags := block.Body.JustAttributes()
+	attributes, diags := Attributes(block.Body)
 	if diags.HasErrors() {
 		return nil, diags
 	}
@@ -94,10 +173,76 @@ func ForEachEntries(block *hcl.Block, ctx *hcl.EvalContext) (map[string]string,
 	return nil, nil
 }
 
+// ValidateInstances checks that a block uses at most one of count and for_each
+func ValidateInstances(block *hcl.Block) hcl.Diagnostics {
+	attributes, diags := Attributes(block.Body)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	_, count := attributes[CountAttr]
+	forEach, ok := attributes[ForEachAttr]
+	if count && ok {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  `"count" and "for_each" are mutually exclusive`,
+			Detail:   "Only one of them can be used to create multiple instances of a block",
+			Subject:  forEach.NameRange.Ptr(),
+			Context:  &block.DefRange,
+		}}
+	}
+
+	return nil
+}
+
+// Count of instances of a block; false if the block doesn't have a count attribute
+func Count(block *hcl.Block, ctx *hcl.EvalContext) (int, bool, hcl.Diagnostics) {
+	attributes, diags := Attributes(block.Body)
+	if diags.HasErrors() {
+		return 0, false, diags
+	}
+
+	attr, ok := attributes[CountAttr]
+	if !ok {
+		return 0, false, nil
+	}
+
+	diags = ValidateInstances(block)
+	if diags.HasErrors() {
+		return 0, false, diags
+	}
+
+	value, diags := attr.Expr.Value(ctx)
+	if diags.HasErrors() {
+		return 0, false, diags
+	}
+
+	var count int
+	err := gocty.FromCtyValue(value, &count)
+	if err != nil || count < 0 {
+		detail := "count must be a whole number greater or equal to zero"
+		if err != nil {
+			detail = err.Error()
+		}
+
+		return 0, false, hcl.Diagnostics{{
+			Severity:    hcl.DiagError,
+			Summary:     `invalid "count"`,
+			Detail:      detail,
+			Subject:     attr.Expr.Range().Ptr(),
+			Context:     &block.DefRange,
+			Expression:  attr.Expr,
+			EvalContext: ctx,
+		}}
+	}
+
+	return count, true, nil
+}
+
 // ValidateAttributes checks that a remaining body only contains
-// depends_on and for_each attributes
+// depends_on, for_each and count attributes
 func ValidateAttributes(body hcl.Body) hcl.Diagnostics {
-	attrs, diags := body.JustAttributes()
+	attrs, diags := Attributes(body)
 	if diags.HasErrors() {
 		return diags
 	}
@@ -112,7 +257,7 @@ func ValidateAttributes(body hcl.Body) hcl.Diagnostics {
 			continue
 		}
 
-		if attr.Name == ForEachAttr {
+		if attr.Name == ForEachAttr || attr.Name == CountAttr {
 			continue
 		}
 
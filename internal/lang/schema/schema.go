@@ -7,10 +7,16 @@ import (
 
 // labels
 const (
-	TaskLabel   = "task"
-	DataLabel   = "data"
-	LocalsLabel = "locals"
-	NameLabel   = "name"
+	TaskLabel     = "task"
+	DataLabel     = "data"
+	LocalsLabel   = "locals"
+	NameLabel     = "name"
+	VariableLabel = "variable"
+	ModuleLabel   = "module"
+	// RetryLabel is only allowed inside of task and data blocks
+	RetryLabel = "retry"
+	// ValidationLabel is only allowed inside of variable blocks
+	ValidationLabel = "validation"
 )
 
 const (
@@ -20,6 +26,10 @@ const (
 	PathScope = "path"
 	// EachScope is automatically injected on resources with for_each meta argument
 	EachScope = "each"
+	// CountScope is automatically injected on resources with count meta argument
+	CountScope = "count"
+	// VarScope for variables since the scope != label
+	VarScope = "var"
 )
 
 // attributes
@@ -30,6 +40,13 @@ const (
 	SourcesAttr     = "sources"
 	DescriptionAttr = "description"
 	ForEachAttr     = "for_each"
+	CountAttr       = "count"
+	TypeAttr        = "type"
+	DefaultAttr     = "default"
+	ConditionAttr   = "condition"
+	ErrorAttr       = "error_message"
+	SourceAttr      = "source"
+	InterpreterAttr = "interpreter"
 )
 
 var (
@@ -38,14 +55,19 @@ var (
 	LocalPrefix = cty.GetAttrPath(LocalScope)
 	PathPrefix  = cty.GetAttrPath(PathScope)
 	EachPrefix  = cty.GetAttrPath(EachScope)
+	VarPrefix   = cty.GetAttrPath(VarScope)
+	CountPrefix = cty.GetAttrPath(CountScope)
+	// ModulePrefix is followed by the name of the module and the path inside of it
+	ModulePrefix = cty.GetAttrPath(ModuleLabel)
 	// KnownPrefixes are the prefixes assigned to anything that is NOT a task
-	KnownPrefixes = cty.NewPathSet(DataPrefix, LocalPrefix, PathPrefix, EachPrefix)
+	KnownPrefixes = cty.NewPathSet(DataPrefix, LocalPrefix, PathPrefix, EachPrefix, VarPrefix, CountPrefix)
 	// IgnorePrefixes are those automatically injected by bake instead of defined by
-	// user input
-	IgnorePrefixes = cty.NewPathSet(PathPrefix, EachPrefix)
+	// user input. Variables are resolved before any task runs
+	IgnorePrefixes = cty.NewPathSet(PathPrefix, EachPrefix, VarPrefix, CountPrefix)
 )
 
 func IsKnownPrefix(path cty.Path) bool {
+	path = WithoutModule(path)
 	for _, prefix := range KnownPrefixes.List() {
 		if path.HasPrefix(prefix) {
 			return true
@@ -55,9 +77,32 @@ func IsKnownPrefix(path cty.Path) bool {
 	return false
 }
 
+// IsIgnoredPrefix is true for references to values injected by bake
+func IsIgnoredPrefix(path cty.Path) bool {
+	for _, prefix := range IgnorePrefixes.List() {
+		if path.HasPrefix(prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithoutModule returns the path inside of the module that path belongs to, ex:
+// module.api.data.version -> data.version
+func WithoutModule(path cty.Path) cty.Path {
+	for len(path) > 2 && path.HasPrefix(ModulePrefix) {
+		path = path[2:]
+	}
+
+	return path
+}
+
 func FileSchema() *hcl.BodySchema {
 	return &hcl.BodySchema{
-		Attributes: nil,
+		Attributes: []hcl.AttributeSchema{
+			{Name: InterpreterAttr},
+		},
 		Blocks: []hcl.BlockHeaderSchema{{
 			Type:       TaskLabel,
 			LabelNames: []string{NameLabel},
@@ -67,6 +112,51 @@ func FileSchema() *hcl.BodySchema {
 		}, {
 			Type:       LocalsLabel,
 			LabelNames: []string{},
+		}, {
+			Type:       VariableLabel,
+			LabelNames: []string{NameLabel},
+		}, {
+			Type:       ModuleLabel,
+			LabelNames: []string{NameLabel},
+		}},
+	}
+}
+
+// NestedSchema are the blocks allowed inside of task and data blocks
+func NestedSchema() *hcl.BodySchema {
+	return &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{
+			Type: RetryLabel,
+		}},
+	}
+}
+
+func VariableSchema() *hcl.BodySchema {
+	return &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: TypeAttr},
+			{Name: DefaultAttr},
+			{Name: DescriptionAttr},
+		},
+		Blocks: []hcl.BlockHeaderSchema{{
+			Type: ValidationLabel,
 		}},
 	}
 }
+
+func ValidationSchema() *hcl.BodySchema {
+	return &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: ConditionAttr, Required: true},
+			{Name: ErrorAttr, Required: true},
+		},
+	}
+}
+
+func ModuleSchema() *hcl.BodySchema {
+	return &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: SourceAttr, Required: true},
+		},
+	}
+}
@@ -1,22 +1,25 @@
 package lang
 
 import (
+	"sort"
 	"sync"
 
 	"bake/internal/lang/config"
 	"bake/internal/lang/meta"
 	"bake/internal/lang/schema"
+	"bake/internal/paths"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/zclconf/go-cty/cty"
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 type Task struct {
 	path             cty.Path
 	filename         string
 	namedInstances   map[string]*TaskInstance // for_each
-	indexedInstances []*TaskInstance          // count?
+	indexedInstances []*TaskInstance          // count
 	singleInstance   *TaskInstance            // plain task
 }
 
@@ -25,10 +28,19 @@ type taskMetadata struct {
 	Block hcl.Range
 	// metadata from block
 	// Description cannot be fetch from Block since it was already decoded
-	Command   hcl.Range
-	Creates   hcl.Range
-	Sources   hcl.Range
-	DependsOn hcl.Range
+	Command     hcl.Range
+	Creates     hcl.Range
+	Sources     hcl.Range
+	Tools       hcl.Range
+	Env         hcl.Range
+	EnvInputs   hcl.Range
+	Workdir     hcl.Range
+	Interpreter hcl.Range
+	DependsOn   hcl.Range
+	Timeout     hcl.Range
+	Output      hcl.Range
+	// metadata from nested blocks
+	Retry retryMetadata
 }
 
 func newTask(raw addressBlock, eval *hcl.EvalContext) (config.Action, hcl.Diagnostics) {
@@ -39,13 +51,42 @@ func newTask(raw addressBlock, eval *hcl.EvalContext) (config.Action, hcl.Diagno
 		return nil, diags
 	}
 
+	metadata.Retry, diags = newRetryMetadata(raw.Block.Body, eval)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	count, counted, diags := schema.Count(raw.Block, eval)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	if counted {
+		instances := make([]*TaskInstance, 0, count)
+		for index := 0; index < count; index++ {
+			ctx := countContext(index, eval.NewChild())
+			task, diags := newTaskInstance(path.IndexInt(index), raw.module, metadata, raw.Block.Body, ctx)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+
+			instances = append(instances, task)
+		}
+
+		return &Task{
+			path:             path,
+			filename:         metadata.Block.Filename,
+			indexedInstances: instances,
+		}, nil
+	}
+
 	forEachEntries, diags := schema.ForEachEntries(raw.Block, eval)
 	if diags.HasErrors() {
 		return nil, diags
 	}
 
 	if len(forEachEntries) == 0 {
-		task, diags := newTaskInstance(path, metadata, raw.Block.Body, eval)
+		task, diags := newTaskInstance(path, raw.module, metadata, raw.Block.Body, eval)
 		if diags.HasErrors() {
 			return nil, diags
 		}
@@ -60,7 +101,7 @@ func newTask(raw addressBlock, eval *hcl.EvalContext) (config.Action, hcl.Diagno
 	instances := map[string]*TaskInstance{}
 	for key, value := range forEachEntries {
 		ctx := eachContext(key, value, eval.NewChild())
-		task, diags := newTaskInstance(path.IndexString(key), metadata, raw.Block.Body, ctx)
+		task, diags := newTaskInstance(path.IndexString(key), raw.module, metadata, raw.Block.Body, ctx)
 		if diags.HasErrors() {
 			return nil, diags
 		}
@@ -86,6 +127,16 @@ func eachContext(key, value string, context *hcl.EvalContext) *hcl.EvalContext {
 	return context
 }
 
+func countContext(index int, context *hcl.EvalContext) *hcl.EvalContext {
+	context.Variables = map[string]cty.Value{
+		"count": cty.ObjectVal(map[string]cty.Value{
+			"index": cty.NumberIntVal(int64(index)),
+		}),
+	}
+
+	return context
+}
+
 func (t Task) GetPath() cty.Path {
 	return t.path
 }
@@ -104,13 +155,13 @@ func (t Task) CTY() cty.Value {
 		return cty.MapVal(m)
 	}
 
-	if len(t.indexedInstances) > 0 {
+	if t.indexedInstances != nil {
 		m := make([]cty.Value, len(t.indexedInstances))
 		for index, instance := range t.indexedInstances {
 			m[index] = instance.CTY()
 		}
 
-		return cty.ListVal(m)
+		return cty.TupleVal(m)
 	}
 
 	return t.singleInstance.CTY()
@@ -122,13 +173,84 @@ func (t *Task) Apply(state *config.State) *sync.WaitGroup {
 
 	}
 
-	if len(t.indexedInstances) > 0 {
+	if t.indexedInstances != nil {
 		return applyIndexed(t.indexedInstances, state)
 	}
 
 	return applySingle(t.singleInstance, state)
 }
 
+// Changed is true if any instance referred by path changed its outputs, ex: gen[1]
+// only refers to the second instance while gen refers to all of them
+func (t Task) Changed(path cty.Path) bool {
+	for _, instance := range t.instances() {
+		if instance.changed && instance.path.HasPrefix(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Outputs returns the digest of the outputs of the instances referred by path; only
+// those whose outputs are known, ex: phony tasks don't have any
+func (t Task) Outputs(path cty.Path) map[string]string {
+	result := map[string]string{}
+	for _, instance := range t.instances() {
+		if digest := instance.outputsDigest(); digest != "" && instance.path.HasPrefix(path) {
+			result[paths.String(instance.path)] = digest
+		}
+	}
+
+	return result
+}
+
+// Upstream marks all instances as dependent on the changed dependencies
+func (t *Task) Upstream(changed []string, outputs map[string]string) {
+	for _, instance := range t.instances() {
+		instance.upstream = slices.Clone(changed)
+		instance.dependencies = outputs
+	}
+}
+
+// Explain why each instance would run; sorted by their path
+func (t Task) Explain() []config.Explanation {
+	result := make([]config.Explanation, 0)
+	for _, instance := range t.instances() {
+		result = append(result, instance.explain())
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+
+	return result
+}
+
+// Sources returns the patterns of all instances of this task; relative to the root recipes
+func (t Task) Sources() []string {
+	result := make([]string, 0)
+	for _, instance := range t.instances() {
+		for _, pattern := range instance.Sources {
+			result = append(result, instance.relative(pattern))
+		}
+	}
+
+	return result
+}
+
+func (t Task) instances() []*TaskInstance {
+	if len(t.namedInstances) > 0 {
+		return maps.Values(t.namedInstances)
+	}
+
+	if t.indexedInstances != nil {
+		return t.indexedInstances
+	}
+
+	return []*TaskInstance{t.singleInstance}
+}
+
 func (t *Task) Hash() []config.Hash {
 	result := make([]config.Hash, 0)
 	if len(t.namedInstances) > 0 {
@@ -141,7 +263,7 @@ func (t *Task) Hash() []config.Hash {
 		return result
 	}
 
-	if len(t.indexedInstances) > 0 {
+	if t.indexedInstances != nil {
 		for _, ri := range t.indexedInstances {
 			hash := ri.Hash()
 			result = append(result, hash)
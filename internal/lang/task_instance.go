@@ -3,87 +3,229 @@ package lang
 import (
 	"fmt"
 	"hash/crc64"
-	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"bake/internal/concurrent"
+	"bake/internal/digest"
+	"bake/internal/event"
 	"bake/internal/lang/config"
 	"bake/internal/lang/schema"
 	"bake/internal/lang/values"
 	"bake/internal/paths"
+	"bake/internal/util"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
 	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 type TaskInstance struct {
 	Description string            `hcl:"description,optional"`
-	Command     string            `hcl:"command,optional"`
-	Creates     string            `hcl:"creates,optional"`
+	Command     cty.Value         `hcl:"command,optional"`
+	Interpreter []string          `hcl:"interpreter,optional"`
+	Creates     cty.Value         `hcl:"creates,optional"`
 	Sources     []string          `hcl:"sources,optional"`
 	Env         map[string]string `hcl:"env,optional"`
+	EnvInputs   []string          `hcl:"env_inputs,optional"`
+	Tools       map[string]string `hcl:"tools,optional"`
+	Timeout     string            `hcl:"timeout,optional"`
+	Output      string            `hcl:"output,optional"`
+	Workdir     string            `hcl:"workdir,optional"`
+	Retry       *Retry            `hcl:"retry,block"`
 	Remain      hcl.Body          `hcl:",remain"`
 	exitCode    values.EventualInt64
 	path        cty.Path
 	metadata    taskMetadata
+	// directory where the command runs; relative to the root recipes. See Workdir
+	dir string
+	// see Command and Interpreter
+	cmd command
+	// names of the env vars explicitly set by the task
+	envKeys []string
+	// explicit dependencies that changed their outputs
+	upstream []string
+	// digest of the outputs of the instances of the explicit dependencies; by their name
+	dependencies map[string]string
+	// whether applying the task changed its outputs
+	changed bool
+	// fingerprints and digests computed while checking whether the task should run
+	tools   map[string]string
+	sources map[string]digest.File
+	targets map[string]digest.File
+	// paths and glob patterns of the files created by the task; see Creates
+	outputs []string
+	// why the task would run or be skipped according to dry run
+	stale []config.Staleness
+	skip  string
+	// maximum duration of the command; zero if unlimited
+	timeout time.Duration
 }
 
-func newTaskInstance(path cty.Path, metadata taskMetadata, body hcl.Body, ctx *hcl.EvalContext) (*TaskInstance, hcl.Diagnostics) {
+func newTaskInstance(path cty.Path, module *Module, metadata taskMetadata, body hcl.Body, ctx *hcl.EvalContext) (*TaskInstance, hcl.Diagnostics) {
 	task := &TaskInstance{path: path, metadata: metadata}
 	diags := gohcl.DecodeBody(body, ctx, task)
 	if diags.HasErrors() {
 		return nil, diags
 	}
 
+	task.dir, diags = workdir(module.root, module.Dir, task.Workdir, &metadata.Workdir, &metadata.Block)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	task.cmd, diags = newCommand(task.Command, task.Interpreter, module, &metadata.Command, &metadata.Interpreter, &metadata.Block)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
 	diags = schema.ValidateAttributes(task.Remain)
 	if diags.HasErrors() {
 		return nil, diags
 	}
 
-	// make sure that irrelevant changes dont taint the state (example from ./dir/file to dir/file)
-	if task.Creates != "" {
-		task.Creates = filepath.Clean(task.Creates)
+	task.timeout, diags = parseDuration("timeout", task.Timeout, &metadata.Timeout, &metadata.Block)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	if task.Output != "" {
+		err := event.ValidateMode(task.Output)
+		if err != nil {
+			return nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "invalid output",
+				Detail:   err.Error(),
+				Subject:  &metadata.Output,
+				Context:  &metadata.Block,
+			}}
+		}
+	}
+
+	diags = task.Retry.validate(metadata.Retry)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	task.outputs, diags = newOutputs(task.Creates, metadata)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	// keep the same value as if it was an empty string
+	if task.Creates.IsNull() {
+		task.Creates = cty.StringVal("")
+	}
+
+	if task.Command.IsNull() {
+		task.Command = cty.StringVal("")
 	}
 
 	// overwrite default env with custom values
+	task.envKeys = maps.Keys(task.Env)
 	task.Env = concurrent.Merge(config.Env(), task.Env)
 	return task, nil
 }
 
+func (t TaskInstance) GetPath() cty.Path {
+	return t.path
+}
+
 func (t TaskInstance) CTY() cty.Value {
 	return values.StructToCty(t)
 }
 
 func (t TaskInstance) Hash() config.Hash {
+	inputs := t.inputEnv()
+	envVars := map[string]string{}
+	for name, value := range inputs {
+		envVars[name] = checksum(value)
+	}
+
 	// somehow iterating over the map creates undeterministic results
-	env := crc64.Checksum([]byte(fmt.Sprintf("%#v", t.Env)), crc64.MakeTable(crc64.ISO))
-	command := crc64.Checksum([]byte(fmt.Sprintf("%#v", []byte(t.Command))), crc64.MakeTable(crc64.ISO))
+	env := checksum(fmt.Sprintf("%#v", inputs))
+	command := checksum(fmt.Sprintf("%#v", []byte(t.cmd.String())))
+	dirty := !t.exitCode.Valid || t.exitCode.Int64 != 0
+	// pending changes of the dependencies are only kept until the task succeeds
+	var upstream []string
+	if dirty {
+		upstream = t.upstream
+	}
 
 	return config.Hash{
-		Path:    paths.String(t.path),
-		Creates: t.Creates,
-		Command: strconv.FormatUint(command, 16),
-		Env:     strconv.FormatUint(env, 16),
-		Dirty:   !t.exitCode.Valid || t.exitCode.Int64 != 0,
+		Path:         paths.String(t.path),
+		Creates:      util.Map(t.outputs, t.relative),
+		Command:      command,
+		Env:          env,
+		EnvVars:      envVars,
+		Tools:        t.tools,
+		Sources:      t.sources,
+		Targets:      t.targets,
+		Dependencies: t.dependencies,
+		Dirty:        dirty,
+		Upstream:     upstream,
+	}
+}
+
+// outputsDigest of the files created by the task; empty if they are unknown
+func (t TaskInstance) outputsDigest() string {
+	if t.targets == nil {
+		return ""
+	}
+
+	var files strings.Builder
+	for _, filename := range sortedKeys(t.targets) {
+		fmt.Fprintf(&files, "%s=%s\x00", filename, t.targets[filename].Digest)
 	}
+
+	return checksum(files.String())
+}
+
+// inputEnv returns the env vars whose changes should trigger a rebuild; those explicitly set
+// by the task and those listed in "env_inputs". Anything else in the process env is ignored
+// such that unrelated changes (ex: PATH or TERM) don't taint the state
+func (t TaskInstance) inputEnv() map[string]string {
+	names := make([]string, 0, len(t.EnvInputs)+len(t.envKeys))
+	names = append(names, t.EnvInputs...)
+	names = append(names, t.envKeys...)
+	result := map[string]string{}
+	for _, name := range names {
+		if value, ok := t.Env[name]; ok {
+			result[name] = value
+		}
+	}
+
+	return result
+}
+
+func checksum(value string) string {
+	sum := crc64.Checksum([]byte(value), crc64.MakeTable(crc64.ISO))
+	return strconv.FormatUint(sum, 16)
 }
 
 func (t *TaskInstance) Apply(state *config.State) hcl.Diagnostics {
 	// don't apply twice in case more than 1 task depends on this
-	if t.exitCode.Valid || t.Command == "" {
+	if t.exitCode.Valid {
 		return nil
 	}
 
-	log := NewLogger(t.path)
+	// tasks without command just pass along the changes of their dependencies
+	if t.cmd.empty() {
+		t.changed = len(t.upstream) > 0
+		return nil
+	}
+
+	log := state.Events.Logger(paths.String(t.path))
 	if state.Flags.Prune {
 		shouldRun, description, diags := t.dryPrune(state)
 		if diags.HasErrors() {
 			return diags
 		}
 
-		log.Println(description)
+		log.Planned(shouldRun || state.Flags.Force, description)
 		if state.Flags.Dry {
 			return nil
 		}
@@ -92,7 +234,7 @@ func (t *TaskInstance) Apply(state *config.State) hcl.Diagnostics {
 			return nil
 		}
 
-		return t.prune(log)
+		return t.prune(state)
 	}
 
 	// run by default
@@ -101,8 +243,17 @@ func (t *TaskInstance) Apply(state *config.State) hcl.Diagnostics {
 		return diags
 	}
 
-	log.Println(description)
+	log.Planned(shouldRun || state.Flags.Force, description)
+	if !shouldRun {
+		// the outputs are still those of the previous run; dependents compare them
+		if oldHash, ok := state.Lock.Get(t.path); ok {
+			t.targets = oldHash.Targets
+		}
+	}
+
 	if state.Flags.Dry {
+		// assume that the outputs would change
+		t.changed = shouldRun
 		return nil
 	}
 
@@ -110,26 +261,60 @@ func (t *TaskInstance) Apply(state *config.State) hcl.Diagnostics {
 		return nil
 	}
 
-	diags = t.run(state.Context, log)
+	restored, diags := t.restore(state, log)
 	if diags.HasErrors() {
 		return diags
 	}
 
+	if !restored {
+		diags = t.Retry.do(state.Context, log, func() (int64, hcl.Diagnostics) {
+			diags := t.run(state.Context, log, t.outputMode(state))
+			return t.exitCode.Int64, diags
+		})
+		if diags.HasErrors() {
+			return diags
+		}
+
+		if len(t.outputs) > 0 {
+			t.targets, diags = t.hashOutputs(state)
+			if diags.HasErrors() {
+				return diags
+			}
+		}
+
+		// keep the digests of the sources used to create the outputs; reusing those from dry run
+		if t.cacheable() {
+			t.sources, _, diags = t.hashSources(state, t.sources)
+			if diags.HasErrors() {
+				return diags
+			}
+		}
+
+		t.save(state, log)
+	}
+
 	// do we need to prune old stuff?
 	oldHash, ok := state.Lock.Get(t.path)
+	t.changed = !ok || t.outputsChanged(oldHash)
 	if !ok {
 		return nil
 	}
 
-	if t.Creates == oldHash.Creates {
+	if slices.Equal(util.Map(t.outputs, t.relative), oldHash.Creates) {
 		return nil
 	}
 
-	err := os.RemoveAll(oldHash.Creates)
+	// locks from older versions only know the declared output
+	old := []string(oldHash.Creates)
+	if oldHash.Targets != nil {
+		old = sortedKeys(oldHash.Targets)
+	}
+
+	err := removeOutputs(old, sortedKeys(t.targets))
 	if err != nil {
 		return hcl.Diagnostics{{
 			Severity: hcl.DiagError,
-			Summary:  fmt.Sprintf(`error pruning %s task's old "creates": %s`, paths.String(t.path), oldHash.Creates),
+			Summary:  fmt.Sprintf(`error pruning %s task's old "creates": %s`, paths.String(t.path), strings.Join(old, ", ")),
 			Detail:   err.Error(),
 			Subject:  &t.metadata.Creates,
 			Context:  &t.metadata.Block,
@@ -138,3 +323,20 @@ func (t *TaskInstance) Apply(state *config.State) hcl.Diagnostics {
 
 	return nil
 }
+
+// outputsChanged compares the outputs against those of a previous run. Phony
+// tasks are always considered changed after running
+func (t TaskInstance) outputsChanged(oldHash *config.Hash) bool {
+	if t.targets == nil || oldHash.Targets == nil || len(t.targets) != len(oldHash.Targets) {
+		return true
+	}
+
+	for filename, target := range t.targets {
+		old, ok := oldHash.Targets[filename]
+		if !ok || old.Digest != target.Digest {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package lang
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"bake/internal/event"
+	"bake/internal/lang/config"
+	"bake/internal/lang/values"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// cacheable tasks are those whose outputs are fully determined by their inputs
+func (t TaskInstance) cacheable() bool {
+	return len(t.Sources) > 0 && len(t.outputs) > 0
+}
+
+// cacheKey identifies the outputs of the task by all of its inputs; including the directory
+// where it runs since its outputs are relative to it
+func (t TaskInstance) cacheKey() string {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "dir=%s\x00", filepath.ToSlash(filepath.Clean(t.dir)))
+	fmt.Fprintf(sum, "command=%s\x00creates=%s\x00", t.cmd.String(), strings.Join(t.outputs, ","))
+	env := t.inputEnv()
+	for _, name := range sortedKeys(env) {
+		fmt.Fprintf(sum, "env:%s=%s\x00", name, env[name])
+	}
+
+	for _, name := range sortedKeys(t.tools) {
+		fmt.Fprintf(sum, "tool:%s=%s\x00", name, t.tools[name])
+	}
+
+	for _, filename := range sortedKeys(t.sources) {
+		fmt.Fprintf(sum, "source:%s=%s\x00", filename, t.sources[filename].Digest)
+	}
+
+	for _, name := range sortedKeys(t.dependencies) {
+		fmt.Fprintf(sum, "dependency:%s=%s\x00", name, t.dependencies[name])
+	}
+
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// restore the task outputs from the cache instead of running its command. Cache
+// errors are only logged since the command can always be run instead
+func (t *TaskInstance) restore(state *config.State, log *event.Logger) (bool, hcl.Diagnostics) {
+	if !t.cacheable() || state.Flags.Force {
+		return false, nil
+	}
+
+	// the sources might not have been hashed by dry run
+	sources, reason, diags := t.hashSources(state, t.sources)
+	if diags.HasErrors() || reason != "" {
+		return false, diags
+	}
+
+	t.sources = sources
+	key := t.cacheKey()
+	files, diags := t.outputFiles(state)
+	if diags.HasErrors() {
+		return false, diags
+	}
+
+	ok, err := state.Cache.Restore(state.Context, key, state.CWD, flatten(files))
+	if err != nil {
+		log.Println("error restoring from cache: " + err.Error())
+		return false, nil
+	}
+
+	if !ok {
+		return false, nil
+	}
+
+	targets, diags := t.hashOutputs(state)
+	if diags.HasErrors() {
+		log.Println("error restoring from cache: " + diags.Error())
+		return false, nil
+	}
+
+	log.Printf("restored from cache %s", key[:12])
+	t.targets = targets
+	t.exitCode = values.EventualInt64{Int64: 0, Valid: true}
+	return true, nil
+}
+
+// save the task outputs into the cache
+func (t *TaskInstance) save(state *config.State, log *event.Logger) {
+	if !t.cacheable() {
+		return
+	}
+
+	err := state.Cache.Save(state.Context, t.cacheKey(), state.CWD, sortedKeys(t.targets))
+	if err != nil {
+		log.Println("error saving to cache: " + err.Error())
+	}
+}
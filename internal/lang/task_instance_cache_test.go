@@ -0,0 +1,69 @@
+package lang
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCacheKey(t *testing.T) {
+	recipe := func(workdir string) string {
+		return `
+task "build" {
+  command = "cat ../in.txt > out.txt"
+  workdir = "` + workdir + `"
+  sources = ["../in.txt"]
+  creates = ["out.txt"]
+}`
+	}
+
+	tests := []struct {
+		name  string
+		first string
+		other string
+		same  bool
+	}{
+		{name: "same workdir", first: "a", other: "a", same: true},
+		{name: "same normalized workdir", first: "a", other: "./a/", same: true},
+		{name: "other workdir", first: "a", other: "b", same: false},
+		{name: "nested workdir", first: "a", other: "a/b", same: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			state := newTestState(t)
+			err := os.MkdirAll("a/b", 0o755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = os.Mkdir("b", 0o755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = os.WriteFile("in.txt", []byte("input"), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			first, other := decodeTask(t, recipe(test.first)), decodeTask(t, recipe(test.other))
+			for _, task := range []*Task{first, other} {
+				sources, _, diags := task.singleInstance.hashSources(state, nil)
+				if diags.HasErrors() {
+					t.Fatal(diags)
+				}
+
+				task.singleInstance.sources = sources
+			}
+
+			// act
+			key, otherKey := first.singleInstance.cacheKey(), other.singleInstance.cacheKey()
+
+			// assert
+			if (key == otherKey) != test.same {
+				t.Errorf("expected the same key to be %t for %s and %s", test.same, test.first, test.other)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package lang
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bake/internal/digest"
+	"bake/internal/lang/config"
+	"bake/internal/paths"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// newOutputs normalizes "creates"; either a single path or a list of paths and glob patterns
+func newOutputs(value cty.Value, metadata taskMetadata) ([]string, hcl.Diagnostics) {
+	if value.IsNull() {
+		return nil, nil
+	}
+
+	outputs := make([]string, 0)
+	if value.Type().Equals(cty.String) {
+		outputs = append(outputs, value.AsString())
+	} else {
+		list, err := convert.Convert(value, cty.List(cty.String))
+		if err == nil {
+			err = gocty.FromCtyValue(list, &outputs)
+		}
+
+		if err != nil {
+			return nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  `"creates" must be either a string or a list of strings`,
+				Detail:   err.Error(),
+				Subject:  &metadata.Creates,
+				Context:  &metadata.Block,
+			}}
+		}
+	}
+
+	result := make([]string, 0, len(outputs))
+	for _, output := range outputs {
+		if output == "" {
+			continue
+		}
+
+		// make sure that irrelevant changes dont taint the state (example from ./dir/file to dir/file)
+		result = append(result, filepath.Clean(output))
+	}
+
+	return result, nil
+}
+
+// relative makes a path of the task relative to the root recipes; files are hashed
+// and stored by their path relative to them
+func (t TaskInstance) relative(filename string) string {
+	return filepath.Join(t.dir, filename)
+}
+
+// outputFiles returns the files currently matched by each output of the task; relative to the root recipes
+func (t TaskInstance) outputFiles(state *config.State) (map[string][]string, hcl.Diagnostics) {
+	result := map[string][]string{}
+	for _, output := range t.outputs {
+		if !isPattern(output) {
+			if _, err := os.Stat(t.relative(output)); err == nil {
+				result[output] = []string{t.relative(output)}
+			}
+
+			continue
+		}
+
+		matches, err := doublestar.Glob(os.DirFS(state.CWD), filepath.ToSlash(t.relative(output)))
+		if err != nil {
+			return nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf(`pattern "%s" is malformed`, output),
+				Detail:   err.Error(),
+				Subject:  &t.metadata.Creates,
+				Context:  &t.metadata.Block,
+			}}
+		}
+
+		if len(matches) > 0 {
+			result[output] = matches
+		}
+	}
+
+	return result, nil
+}
+
+// hashOutputs computes the digest of every file created by the task; all outputs MUST exist
+func (t TaskInstance) hashOutputs(state *config.State) (map[string]digest.File, hcl.Diagnostics) {
+	files, diags := t.outputFiles(state)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	result := map[string]digest.File{}
+	for _, output := range t.outputs {
+		if _, ok := files[output]; !ok {
+			return nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf(`"%s" didn't create the expected file "%s"`, paths.String(t.path), output),
+				Subject:  &t.metadata.Creates,
+				Context:  &t.metadata.Block,
+			}}
+		}
+
+		for _, filename := range files[output] {
+			file, err := digest.NewFile(filename, nil)
+			if err != nil {
+				return nil, hcl.Diagnostics{{
+					Severity: hcl.DiagError,
+					Summary:  fmt.Sprintf(`error hashing "%s"`, filename),
+					Detail:   err.Error(),
+					Subject:  &t.metadata.Creates,
+					Context:  &t.metadata.Block,
+				}}
+			}
+
+			result[filename] = file
+		}
+	}
+
+	return result, nil
+}
+
+// oldestOutput returns the modification time of the oldest file created by the task
+func oldestOutput(files map[string][]string) (string, time.Time) {
+	oldest, modTime := "", time.Time{}
+	for _, output := range sortedKeys(files) {
+		for _, filename := range files[output] {
+			info, err := os.Stat(filename)
+			if err != nil {
+				continue
+			}
+
+			if oldest == "" || info.ModTime().Before(modTime) {
+				oldest, modTime = filename, info.ModTime()
+			}
+		}
+	}
+
+	return oldest, modTime
+}
+
+// removeOutputs removes the files in old that are not part of current
+func removeOutputs(old, current []string) error {
+	keep := map[string]bool{}
+	for _, filename := range current {
+		keep[filename] = true
+	}
+
+	for _, filename := range old {
+		if keep[filename] || contains(filename, current) {
+			continue
+		}
+
+		err := os.RemoveAll(filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// contains is true if any of the filenames is inside of dir
+func contains(dir string, filenames []string) bool {
+	for _, filename := range filenames {
+		if strings.HasPrefix(filename, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flatten the files matched by each output
+func flatten(files map[string][]string) []string {
+	result := make([]string, 0)
+	for _, output := range sortedKeys(files) {
+		result = append(result, files[output]...)
+	}
+
+	return result
+}
+
+func isPattern(output string) bool {
+	return strings.ContainsAny(output, "*?[{")
+}
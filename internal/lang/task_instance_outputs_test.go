@@ -0,0 +1,88 @@
+package lang
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     []string
+		current []string
+		removed []string
+		kept    []string
+	}{
+		{
+			name:    "renamed output",
+			old:     []string{"old.bin"},
+			current: []string{"new.bin"},
+			removed: []string{"old.bin"},
+			kept:    []string{"new.bin"},
+		},
+		{
+			name:    "same outputs",
+			old:     []string{"old.bin", "new.bin"},
+			current: []string{"old.bin", "new.bin"},
+			kept:    []string{"old.bin", "new.bin"},
+		},
+		{
+			name:    "file no longer matched by a glob",
+			old:     []string{"dist/a.js", "dist/b.js"},
+			current: []string{"dist/a.js"},
+			removed: []string{"dist/b.js"},
+			kept:    []string{"dist/a.js"},
+		},
+		{
+			name:    "directory containing current outputs",
+			old:     []string{"dist"},
+			current: []string{"dist/a.js"},
+			kept:    []string{"dist/a.js", "dist/b.js"},
+		},
+		{
+			name:    "directory without current outputs",
+			old:     []string{"dist"},
+			current: []string{"new.bin"},
+			removed: []string{"dist/a.js", "dist/b.js"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			chdir(t, t.TempDir())
+			for _, filename := range []string{"old.bin", "new.bin", "dist/a.js", "dist/b.js"} {
+				err := os.MkdirAll(filepath.Dir(filename), 0o755)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				err = os.WriteFile(filename, []byte(filename), 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// act
+			err := removeOutputs(test.old, test.current)
+
+			// assert
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, filename := range test.removed {
+				if _, err := os.Stat(filename); err == nil {
+					t.Errorf(`expected "%s" to be removed`, filename)
+				}
+			}
+
+			for _, filename := range test.kept {
+				if _, err := os.Stat(filename); err != nil {
+					t.Errorf(`expected "%s" to be kept: %v`, filename, err)
+				}
+			}
+		})
+	}
+}
@@ -2,8 +2,8 @@ package lang
 
 import (
 	"fmt"
-	"log"
 	"os"
+	"strings"
 
 	"bake/internal/lang/config"
 	"bake/internal/paths"
@@ -16,28 +16,39 @@ func (t TaskInstance) dryPrune(state *config.State) (shouldApply bool, reason st
 		return true, "force prunning is in effect", nil
 	}
 
-	if t.Creates == "" {
+	if len(t.outputs) == 0 {
 		return false, "nothing to prune", nil
 	}
 
-	stat, err := os.Stat(t.Creates)
-	if err != nil {
-		return false, fmt.Sprintf(`"%s" doesn't exist`, t.Creates), nil
+	files, diags := t.outputFiles(state)
+	if diags.HasErrors() {
+		return false, "", diags
 	}
 
-	return true, fmt.Sprintf(`will delete "%s"`, stat.Name()), nil
+	if len(files) == 0 {
+		return false, fmt.Sprintf(`"%s" doesn't exist`, strings.Join(t.outputs, `", "`)), nil
+	}
+
+	return true, fmt.Sprintf(`will delete "%s"`, strings.Join(flatten(files), `", "`)), nil
 }
 
-func (t *TaskInstance) prune(log *log.Logger) hcl.Diagnostics {
-	err := os.RemoveAll(t.Creates)
-	if err != nil {
-		return hcl.Diagnostics{{
-			Severity: hcl.DiagError,
-			Summary:  "error pruning task " + paths.String(t.path),
-			Detail:   err.Error(),
-			Subject:  &t.metadata.Creates,
-			Context:  &t.metadata.Block,
-		}}
+func (t *TaskInstance) prune(state *config.State) hcl.Diagnostics {
+	files, diags := t.outputFiles(state)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	for _, filename := range flatten(files) {
+		err := os.RemoveAll(filename)
+		if err != nil {
+			return hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "error pruning task " + paths.String(t.path),
+				Detail:   err.Error(),
+				Subject:  &t.metadata.Creates,
+				Context:  &t.metadata.Block,
+			}}
+		}
 	}
 
 	return nil
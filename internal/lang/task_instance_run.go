@@ -1,42 +1,103 @@
 package lang
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"log"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
-	"time"
 
+	"bake/internal/digest"
+	"bake/internal/event"
 	"bake/internal/lang/config"
 	"bake/internal/lang/values"
 	"bake/internal/paths"
+	"bake/internal/util"
 
 	"github.com/bmatcuk/doublestar/v4"
 	"github.com/hashicorp/hcl/v2"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
-func (t TaskInstance) dryRun(state *config.State) (shouldApply bool, reason string, diags hcl.Diagnostics) {
+func (t *TaskInstance) dryRun(state *config.State) (shouldApply bool, reason string, diags hcl.Diagnostics) {
+	// fingerprint tools even on force run since they are kept in the lock file
+	diags = t.fingerprintTools(state)
+	if diags.HasErrors() {
+		return false, "", diags
+	}
+
 	if state.Flags.Force {
 		return true, "force run is in effect", nil
 	}
 
+	t.stale, t.skip, diags = t.staleness(state)
+	if diags.HasErrors() {
+		return false, "", diags
+	}
+
+	if len(t.stale) > 0 {
+		return true, t.stale[0].Reason + " ... baking", nil
+	}
+
+	return false, t.skip, nil
+}
+
+// staleness evaluates every criteria that makes the task run; the reason to skip
+// the task is returned if none applies. Tools MUST be already fingerprinted
+func (t *TaskInstance) staleness(state *config.State) ([]config.Staleness, string, hcl.Diagnostics) {
+	stale := make([]config.Staleness, 0)
 	oldHash, ok := state.Lock.Get(t.path)
 	if ok {
+		// dependencies that changed on previous runs where the task didn't succeed
+		for _, name := range oldHash.Upstream {
+			if !slices.Contains(t.upstream, name) {
+				t.upstream = append(t.upstream, name)
+			}
+		}
+
+		// dependencies that changed their outputs since the task last ran, ex: by running them alone.
+		// Locks from older versions don't know the outputs of the dependencies
+		for _, name := range sortedKeys(t.dependencies) {
+			old, known := oldHash.Dependencies[name]
+			if oldHash.Dependencies != nil && (!known || old != t.dependencies[name]) && !slices.Contains(t.upstream, name) {
+				t.upstream = append(t.upstream, name)
+			}
+		}
+
 		hash := t.Hash()
-		if hash.Creates != oldHash.Creates {
-			return true, `"creates" has changed ... baking`, nil
+		if !slices.Equal(hash.Creates, oldHash.Creates) {
+			stale = append(stale, config.Staleness{Reason: `"creates" has changed`, Subject: &t.metadata.Creates})
 		}
 
 		if hash.Command != oldHash.Command {
-			return true, `"command" has changed ... baking`, nil
+			stale = append(stale, config.Staleness{Reason: `"command" has changed`, Subject: &t.metadata.Command})
 		}
+
+		// locks from older versions don't know which env vars the task depends on
+		if oldHash.EnvVars != nil {
+			for _, name := range changes(hash.EnvVars, oldHash.EnvVars) {
+				subject := &t.metadata.EnvInputs
+				if slices.Contains(t.envKeys, name) {
+					subject = &t.metadata.Env
+				}
+
+				stale = append(stale, config.Staleness{Reason: fmt.Sprintf(`env "%s" has changed`, name), Subject: subject})
+			}
+		}
+
+		for _, name := range changes(hash.Tools, oldHash.Tools) {
+			stale = append(stale, config.Staleness{Reason: fmt.Sprintf(`tool "%s" has changed`, name), Subject: &t.metadata.Tools})
+		}
+	}
+
+	if len(t.upstream) > 0 {
+		stale = append(stale, t.upstreamStaleness())
 	}
 
-	if t.Command == "" && t.Creates != "" {
-		return false, "", hcl.Diagnostics{{
+	if t.cmd.empty() && len(t.outputs) > 0 {
+		return nil, "", hcl.Diagnostics{{
 			Severity: hcl.DiagError,
 			Summary:  `"command" cannot be empty when "creates" is provided`,
 			Subject:  &t.metadata.Creates,
@@ -45,22 +106,149 @@ func (t TaskInstance) dryRun(state *config.State) (shouldApply bool, reason stri
 	}
 
 	// phony task
-	if len(t.Sources) == 0 || t.Creates == "" {
-		return true, `"sources" or "creates" was not specified ... baking phony task`, nil
+	if len(t.Sources) == 0 || len(t.outputs) == 0 {
+		stale = append(stale, config.Staleness{Reason: `"sources" or "creates" was not specified`, Subject: &t.metadata.Block})
+		return stale, "", nil
+	}
+
+	// if any output doesn't exist then it should be created
+	files, diags := t.outputFiles(state)
+	if diags.HasErrors() {
+		return nil, "", diags
 	}
 
-	// if the target doesn't exist then it should be created
-	targetInfo, err := os.Stat(t.Creates)
-	if err != nil {
-		return true, fmt.Sprintf(`"%s" doesn't exists ... baking`, t.Creates), nil
+	for _, output := range t.outputs {
+		if _, exists := files[output]; !exists {
+			stale = append(stale, config.Staleness{Reason: fmt.Sprintf(`"%s" doesn't exists`, output), Subject: &t.metadata.Creates})
+		}
+	}
+
+	var oldSources map[string]digest.File
+	if ok {
+		oldSources = oldHash.Sources
 	}
 
+	sources, reason, diags := t.hashSources(state, oldSources)
+	if diags.HasErrors() || reason != "" {
+		return stale, reason, diags
+	}
+
+	// keep them to avoid hashing the sources again after running
+	t.sources = sources
+	creates := strings.Join(t.outputs, ", ")
+	// without digests from a previous run we can only rely on modification times
+	if !ok || oldHash.Sources == nil || oldHash.Targets == nil {
+		oldest, modTime := oldestOutput(files)
+		if oldest == "" {
+			return stale, "", nil
+		}
+
+		for _, filename := range sortedKeys(sources) {
+			// sources are newer than the oldest output, create it
+			if sources[filename].ModTime.After(modTime) {
+				stale = append(stale, config.Staleness{
+					Reason:  fmt.Sprintf(`source "%s" is newer than "%s"`, filename, oldest),
+					Subject: &t.metadata.Sources,
+				})
+			}
+		}
+
+		return stale, fmt.Sprintf(`"%s" is newer than "%s" ... skipping`, creates, strings.Join(t.Sources, ", ")), nil
+	}
+
+	current := map[string]bool{}
+	for _, filename := range flatten(files) {
+		current[filename] = true
+		var previous *digest.File
+		if old, known := oldHash.Targets[filename]; known {
+			previous = &old
+		}
+
+		target, err := digest.NewFile(filename, previous)
+		if err != nil {
+			return nil, "", hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf(`error hashing "%s"`, filename),
+				Detail:   err.Error(),
+				Subject:  &t.metadata.Creates,
+				Context:  &t.metadata.Block,
+			}}
+		}
+
+		if previous == nil || target.Digest != previous.Digest {
+			stale = append(stale, config.Staleness{
+				Reason:  fmt.Sprintf(`"%s" was modified outside of bake`, filename),
+				Subject: &t.metadata.Creates,
+			})
+		}
+	}
+
+	for _, filename := range sortedKeys(oldHash.Targets) {
+		// missing outputs were already reported
+		if !current[filename] && !slices.Contains(util.Map(t.outputs, t.relative), filename) {
+			stale = append(stale, config.Staleness{
+				Reason:  fmt.Sprintf(`"%s" was removed outside of bake`, filename),
+				Subject: &t.metadata.Creates,
+			})
+		}
+	}
+
+	for _, filename := range sortedKeys(sources) {
+		old, ok := oldHash.Sources[filename]
+		if !ok {
+			stale = append(stale, config.Staleness{Reason: fmt.Sprintf(`source "%s" was added`, filename), Subject: &t.metadata.Sources})
+			continue
+		}
+
+		if old.Digest != sources[filename].Digest {
+			stale = append(stale, config.Staleness{Reason: fmt.Sprintf(`source "%s" has changed`, filename), Subject: &t.metadata.Sources})
+		}
+	}
+
+	for _, filename := range sortedKeys(oldHash.Sources) {
+		if _, ok := sources[filename]; !ok {
+			stale = append(stale, config.Staleness{Reason: fmt.Sprintf(`source "%s" was removed`, filename), Subject: &t.metadata.Sources})
+		}
+	}
+
+	return stale, fmt.Sprintf(`"%s" is up to date with "%s" ... skipping`, creates, strings.Join(t.Sources, ", ")), nil
+}
+
+// upstreamStaleness explains the changes of the explicit dependencies
+func (t TaskInstance) upstreamStaleness() config.Staleness {
+	return config.Staleness{
+		Reason:       fmt.Sprintf(`dependency "%s" has changed`, strings.Join(t.upstream, `", "`)),
+		Subject:      &t.metadata.DependsOn,
+		Dependencies: t.upstream,
+	}
+}
+
+// explain why the instance would run according to its last dry run
+func (t TaskInstance) explain() config.Explanation {
+	explanation := config.Explanation{Path: paths.String(t.path), Stale: t.stale, Skip: t.skip}
+	// tasks without command just pass along the changes of their dependencies
+	if t.cmd.empty() {
+		explanation.Stale = nil
+		explanation.Skip = "none of its dependencies changed"
+		if len(t.upstream) > 0 {
+			explanation.Stale = []config.Staleness{t.upstreamStaleness()}
+		}
+	}
+
+	return explanation
+}
+
+// hashSources computes the digest of every file matched by the task sources; the old digests are
+// reused for files whose modification time and size didn't change. A reason is returned if a
+// pattern doesn't match any file
+func (t TaskInstance) hashSources(state *config.State, old map[string]digest.File) (map[string]digest.File, string, hcl.Diagnostics) {
+	FS := os.DirFS(state.CWD)
+	result := map[string]digest.File{}
 	for _, pattern := range t.Sources {
 		// Check pattern is well-formed.
-		FS := os.DirFS(state.CWD)
-		matches, err := doublestar.Glob(FS, pattern)
+		matches, err := doublestar.Glob(FS, filepath.ToSlash(t.relative(pattern)))
 		if err != nil {
-			return false, "", hcl.Diagnostics{{
+			return nil, "", hcl.Diagnostics{{
 				Severity: hcl.DiagError,
 				Summary:  fmt.Sprintf(`pattern "%s" is malformed`, pattern),
 				Detail:   err.Error(),
@@ -70,91 +258,123 @@ func (t TaskInstance) dryRun(state *config.State) (shouldApply bool, reason stri
 		}
 
 		if len(matches) == 0 {
-			return false, fmt.Sprintf(`pattern "%s" doesn't match anything ... skipping`, strings.Join(t.Sources, ", ")), nil
+			return nil, fmt.Sprintf(`pattern "%s" doesn't match anything ... skipping`, strings.Join(t.Sources, ", ")), nil
 		}
 
 		for _, filename := range matches {
-			info, err := os.Stat(filename)
+			var previous *digest.File
+			if file, ok := old[filename]; ok {
+				previous = &file
+			}
+
+			file, err := digest.NewFile(filename, previous)
 			if err != nil {
-				return false, "", hcl.Diagnostics{{
+				return nil, "", hcl.Diagnostics{{
 					Severity: hcl.DiagError,
-					Summary:  fmt.Sprintf(`error getting "%s" stat information`, filename),
+					Summary:  fmt.Sprintf(`error hashing "%s"`, filename),
 					Detail:   err.Error(),
 					Subject:  &t.metadata.Sources,
 					Context:  &t.metadata.Block,
 				}}
 			}
 
-			// sources are newer than target, create it
-			if info.ModTime().After(targetInfo.ModTime()) {
-				return true, fmt.Sprintf(`source "%s" is newer than "%s" ... baking`, filename, t.Creates), nil
-			}
+			result[filename] = file
 		}
 	}
 
-	return false, fmt.Sprintf(`"%s" is newer than "%s" ... skipping`, t.Creates, strings.Join(t.Sources, "")), nil
+	return result, "", nil
 }
 
-func (t *TaskInstance) run(ctx context.Context, log *log.Logger) hcl.Diagnostics {
-	// determine which shell to use
-	terminal := "bash"
-	shell, ok := os.LookupEnv("SHELL")
-	if ok {
-		terminal = shell
-	}
-
-	// use fail fast flags
-	script := fmt.Sprintf(`
-	set -euo pipefail
-
-	%s`, t.Command)
-	command := exec.CommandContext(ctx, terminal, "-c", script)
-	command.Env = config.EnvSlice(t.Env)
-	// todo: should this be configurable?
-	var stdout, stderr bytes.Buffer
-	command.Stdout = &stdout
-	command.Stderr = &stderr
-	start := time.Now()
-	err := command.Run()
-	end := time.Now()
-	// command.ProcessState.UserTime().String() provides inconsistent results
-	// if the process is just iddling
-	log.Println(`done in ` + end.Sub(start).String())
+// fingerprintTools runs the version probe of every tool declared by the task; probes
+// are shared with other tasks declaring the same one in the same directory. Probes run with
+// the user's shell no matter the interpreter of the task
+func (t *TaskInstance) fingerprintTools(state *config.State) hcl.Diagnostics {
+	t.tools = map[string]string{}
+	for _, name := range sortedKeys(t.Tools) {
+		probe := command{script: t.Tools[name]}
+		version, err := state.Tools.Fingerprint(t.dir+"\x00"+probe.script, func() (string, error) {
+			return probe.output(state.Context, t.dir)
+		})
+		if err != nil {
+			return hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf(`error probing the version of tool "%s"`, name),
+				Detail:   err.Error(),
+				Subject:  &t.metadata.Tools,
+				Context:  &t.metadata.Block,
+			}}
+		}
+
+		t.tools[name] = version
+	}
+
+	return nil
+}
+
+// changes returns the keys whose values differ; including those that were added or removed
+func changes(current, old map[string]string) []string {
+	result := make([]string, 0)
+	for _, name := range sortedKeys(current) {
+		if current[name] != old[name] {
+			result = append(result, name)
+		}
+	}
+
+	for _, name := range sortedKeys(old) {
+		if _, ok := current[name]; !ok {
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := maps.Keys(m)
+	sort.Strings(keys)
+	return keys
+}
+
+func (t *TaskInstance) run(ctx context.Context, log *event.Logger, mode string) hcl.Diagnostics {
+	result := t.cmd.run(ctx, log, mode, t.dir, t.Env, t.timeout)
 	// store results
 	t.exitCode = values.EventualInt64{
-		Int64: int64(command.ProcessState.ExitCode()),
+		Int64: result.exitCode,
 		Valid: true,
 	}
 
-	detail := strings.TrimSpace(stderr.String())
-	if detail == "" {
-		// just in case the program didn't output anything to std err
-		detail = strings.TrimSpace(stdout.String())
-	}
-
-	if err != nil {
+	if result.timedOut {
 		return hcl.Diagnostics{{
 			Severity: hcl.DiagError,
-			Summary:  fmt.Sprintf(`"%s" task failed with "%s"`, paths.String(t.path), command.ProcessState.String()),
-			Detail:   detail,
-			Subject:  &t.metadata.Command,
+			Summary:  fmt.Sprintf(`"%s" task timed out after %s`, paths.String(t.path), t.timeout),
+			Detail:   result.detail(),
+			Subject:  &t.metadata.Timeout,
 			Context:  &t.metadata.Block,
 		}}
 	}
 
-	if t.Creates == "" {
-		return nil
-	}
-
-	_, err = os.Stat(t.Creates)
-	if err != nil {
+	if result.err != nil {
 		return hcl.Diagnostics{{
 			Severity: hcl.DiagError,
-			Summary:  fmt.Sprintf(`"%s" didn't create the expected file "%s"`, paths.String(t.path), t.Creates),
-			Subject:  &t.metadata.Creates,
+			Summary:  fmt.Sprintf(`"%s" task failed with "%s"`, paths.String(t.path), result.state),
+			Detail:   result.detail(),
+			Subject:  &t.metadata.Command,
 			Context:  &t.metadata.Block,
 		}}
 	}
 
 	return nil
 }
+
+// outputMode of the task; the one from the command line takes precedence
+func (t *TaskInstance) outputMode(state *config.State) string {
+	if state.Flags.Output != "" && state.Flags.Output != config.OutputJSON {
+		return state.Flags.Output
+	}
+
+	if t.Output != "" {
+		return t.Output
+	}
+
+	return event.Interleaved
+}
@@ -0,0 +1,431 @@
+package lang
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"bake/internal/lang/config"
+	"bake/internal/lang/schema"
+	"bake/internal/lang/values"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// newTestState of a run in a temporary directory such that the files of each test are isolated
+func newTestState(t *testing.T) *config.State {
+	t.Helper()
+	chdir(t, t.TempDir())
+	state, err := config.NewState(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return state
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(previous)
+	})
+}
+
+// decodeTask decodes the first block of the recipe as a task of the root recipes in the working directory
+func decodeTask(t *testing.T, recipe string) *Task {
+	t.Helper()
+	file, diags := hclparse.NewParser().ParseHCL([]byte(recipe), "main.hcl")
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	content, diags := file.Body.Content(schema.FileSchema())
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	// the tests run in the root recipes directory
+	root, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := addressBlock{Block: content.Blocks[0], module: NewRootModule(root)}
+	action, diags := address.Decode(&hcl.EvalContext{Functions: schema.Functions()})
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	return action.(*Task)
+}
+
+// reasons of the staleness that contain text
+func reasons(stale []config.Staleness, text string) []string {
+	result := make([]string, 0)
+	for _, staleness := range stale {
+		if strings.Contains(staleness.Reason, text) {
+			result = append(result, staleness.Reason)
+		}
+	}
+
+	return result
+}
+
+func TestEnvInputsStaleness(t *testing.T) {
+	recipe := func(mode string) string {
+		return `
+task "build" {
+  command    = "true"
+  creates    = ["out.txt"]
+  env        = { MODE = "` + mode + `" }
+  env_inputs = ["BAKE_TEST_INPUT"]
+}`
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		other string
+		mode  string
+		want  []string
+	}{
+		{name: "unchanged", input: "a", other: "a", mode: "release", want: []string{}},
+		{name: "input changed", input: "b", other: "a", mode: "release", want: []string{`env "BAKE_TEST_INPUT" has changed`}},
+		{name: "unrelated env changed", input: "a", other: "b", mode: "release", want: []string{}},
+		{name: "task env changed", input: "a", other: "a", mode: "debug", want: []string{`env "MODE" has changed`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			state := newTestState(t)
+			t.Setenv("BAKE_TEST_INPUT", "a")
+			t.Setenv("BAKE_TEST_OTHER", "a")
+			previous := decodeTask(t, recipe("release"))
+			previous.singleInstance.exitCode = values.EventualInt64{Int64: 0, Valid: true}
+			state.Lock.Update(previous)
+			t.Setenv("BAKE_TEST_INPUT", test.input)
+			t.Setenv("BAKE_TEST_OTHER", test.other)
+
+			// act
+			stale, _, diags := decodeTask(t, recipe(test.mode)).singleInstance.staleness(state)
+
+			// assert
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			got := reasons(stale, "env")
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("expected %v but got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestToolsStaleness(t *testing.T) {
+	recipe := `
+task "build" {
+  command = "true"
+  creates = ["out.txt"]
+  tools   = { fake = "echo $BAKE_TEST_TOOL" }
+}`
+
+	tests := []struct {
+		name    string
+		version string
+		want    []string
+	}{
+		{name: "same version", version: "1.0.0", want: []string{}},
+		{name: "new version", version: "1.1.0", want: []string{`tool "fake" has changed`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			state := newTestState(t)
+			t.Setenv("BAKE_TEST_TOOL", "1.0.0")
+			previous := decodeTask(t, recipe)
+			diags := previous.singleInstance.fingerprintTools(state)
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			previous.singleInstance.exitCode = values.EventualInt64{Int64: 0, Valid: true}
+			state.Lock.Update(previous)
+			t.Setenv("BAKE_TEST_TOOL", test.version)
+			// probes are only run once per run
+			state.Tools = config.NewTools()
+			task := decodeTask(t, recipe)
+
+			// act
+			diags = task.singleInstance.fingerprintTools(state)
+			stale, _, moreDiags := task.singleInstance.staleness(state)
+
+			// assert
+			diags = append(diags, moreDiags...)
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			got := reasons(stale, "tool")
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("expected %v but got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestToolsProbedOnce(t *testing.T) {
+	// arrange
+	state := newTestState(t)
+	recipe := `
+task "build" {
+  command = "true"
+  tools   = { fake = "echo probed >> probes.txt && echo 1.0.0" }
+}`
+	first, second := decodeTask(t, recipe), decodeTask(t, recipe)
+
+	// act
+	diags := first.singleInstance.fingerprintTools(state)
+	diags = append(diags, second.singleInstance.fingerprintTools(state)...)
+
+	// assert
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	content, err := os.ReadFile("probes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Count(string(content), "probed") != 1 {
+		t.Errorf("expected the probe to run once but got %q", content)
+	}
+
+	if second.singleInstance.tools["fake"] != "1.0.0" {
+		t.Errorf(`expected version "1.0.0" but got "%s"`, second.singleInstance.tools["fake"])
+	}
+}
+
+func TestToolsProbeFailure(t *testing.T) {
+	// arrange
+	state := newTestState(t)
+	task := decodeTask(t, `
+task "build" {
+  command = "true"
+  tools   = { fake = "echo missing && exit 127" }
+}`)
+
+	// act
+	diags := task.singleInstance.fingerprintTools(state)
+
+	// assert
+	if !diags.HasErrors() {
+		t.Fatal("expected an error diagnostic")
+	}
+
+	if diags[0].Summary != `error probing the version of tool "fake"` {
+		t.Errorf("unexpected summary %s", diags[0].Summary)
+	}
+
+	if !strings.Contains(diags[0].Detail, "missing") {
+		t.Errorf("expected the probe output in the detail but got %s", diags[0].Detail)
+	}
+}
+
+func TestUpstreamKeptUntilSuccess(t *testing.T) {
+	recipe := `
+task "build" {
+  command    = "true"
+  creates    = ["out.txt"]
+  depends_on = [gen]
+}`
+
+	tests := []struct {
+		name     string
+		exitCode int64
+		want     []string
+	}{
+		{name: "dependent failed", exitCode: 1, want: []string{`dependency "gen" has changed`}},
+		{name: "dependent succeeded", exitCode: 0, want: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			state := newTestState(t)
+			previous := decodeTask(t, recipe)
+			previous.singleInstance.exitCode = values.EventualInt64{Int64: 0, Valid: true}
+			state.Lock.Update(previous)
+			current := decodeTask(t, recipe)
+			current.Upstream([]string{"gen"}, nil)
+			current.singleInstance.exitCode = values.EventualInt64{Int64: test.exitCode, Valid: true}
+			state.Lock.Update(current)
+
+			// act
+			stale, _, diags := decodeTask(t, recipe).singleInstance.staleness(state)
+
+			// assert
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			got := reasons(stale, "dependency")
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("expected %v but got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestStalenessReasons(t *testing.T) {
+	recipe := func(command string) string {
+		return `
+task "build" {
+  command = "` + command + `"
+  sources = ["*.txt"]
+  creates = ["out.bin"]
+}`
+	}
+
+	write := func(t *testing.T, filename, content string) {
+		t.Helper()
+		err := os.WriteFile(filename, []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		change  func(t *testing.T)
+		want    []string
+	}{
+		{
+			name:    "up to date",
+			command: "cat *.txt > out.bin",
+			change:  func(t *testing.T) {},
+			want:    []string{},
+		},
+		{
+			name:    "command",
+			command: "cat *.txt | sort > out.bin",
+			change:  func(t *testing.T) {},
+			want:    []string{`"command" has changed`},
+		},
+		{
+			name:    "sources",
+			command: "cat *.txt > out.bin",
+			change: func(t *testing.T) {
+				write(t, "a.txt", "changed a")
+				write(t, "c.txt", "c")
+				_ = os.Remove("b.txt")
+			},
+			want: []string{`source "a.txt" has changed`, `source "c.txt" was added`, `source "b.txt" was removed`},
+		},
+		{
+			name:    "missing output",
+			command: "cat *.txt > out.bin",
+			change: func(t *testing.T) {
+				_ = os.Remove("out.bin")
+			},
+			want: []string{`"out.bin" doesn't exists`},
+		},
+		{
+			name:    "everything",
+			command: "cat *.txt | sort > out.bin",
+			change: func(t *testing.T) {
+				write(t, "a.txt", "changed a")
+				write(t, "out.bin", "changed outside")
+			},
+			want: []string{
+				`"command" has changed`,
+				`"out.bin" was modified outside of bake`,
+				`source "a.txt" has changed`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			state := newTestState(t)
+			write(t, "a.txt", "a")
+			write(t, "b.txt", "b")
+			previous := decodeTask(t, recipe("cat *.txt > out.bin"))
+			diags := previous.singleInstance.Apply(state)
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			state.Lock.Update(previous)
+			test.change(t)
+
+			// act
+			stale, _, diags := decodeTask(t, recipe(test.command)).singleInstance.staleness(state)
+
+			// assert
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			got := reasons(stale, "")
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("expected %v but got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestToolsProbeWorkdir(t *testing.T) {
+	// arrange
+	state := newTestState(t)
+	err := os.Mkdir("sub", 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := decodeTask(t, `
+task "root" {
+  command = "true"
+  tools   = { dir = "basename $(pwd)" }
+}`)
+	sub := decodeTask(t, `
+task "sub" {
+  command = "true"
+  workdir = "sub"
+  tools   = { dir = "basename $(pwd)" }
+}`)
+
+	// act
+	diags := root.singleInstance.fingerprintTools(state)
+	diags = append(diags, sub.singleInstance.fingerprintTools(state)...)
+
+	// assert
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	if sub.singleInstance.tools["dir"] != "sub" {
+		t.Errorf(`expected the probe to run in "sub" but got "%s"`, sub.singleInstance.tools["dir"])
+	}
+
+	if root.singleInstance.tools["dir"] == "sub" {
+		t.Errorf("expected the probe of the root task to run in the root directory")
+	}
+}
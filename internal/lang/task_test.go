@@ -0,0 +1,116 @@
+package lang
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"bake/internal/lang/config"
+	"bake/internal/util"
+)
+
+func TestTaskExplain(t *testing.T) {
+	tests := []struct {
+		name     string
+		recipe   string
+		upstream []string
+		paths    []string
+		reason   string
+	}{
+		{
+			name: "plain",
+			recipe: `
+task "build" {
+  command    = "true"
+  depends_on = [gen]
+}`,
+			upstream: []string{"gen"},
+			paths:    []string{"build"},
+			reason:   `dependency "gen" has changed`,
+		},
+		{
+			name: "count",
+			recipe: `
+task "build" {
+  count      = 2
+  command    = "true"
+  depends_on = [gen[0]]
+}`,
+			upstream: []string{"gen[0]"},
+			paths:    []string{"build[0]", "build[1]"},
+			reason:   `dependency "gen[0]" has changed`,
+		},
+		{
+			name: "for_each",
+			recipe: `
+task "build" {
+  for_each   = { linux = "amd64", darwin = "arm64" }
+  command    = "true"
+  depends_on = [gen["linux"]]
+}`,
+			upstream: []string{`gen["linux"]`},
+			paths:    []string{`build["darwin"]`, `build["linux"]`},
+			reason:   `dependency "gen["linux"]" has changed`,
+		},
+		{
+			name: "no changes",
+			recipe: `
+task "build" {
+  count      = 2
+  command    = "true"
+  sources    = ["*.txt"]
+  creates    = ["out.txt"]
+  depends_on = [gen]
+}`,
+			upstream: nil,
+			paths:    []string{"build[0]", "build[1]"},
+			reason:   `"out.txt" doesn't exists`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			state := newTestState(t)
+			err := os.WriteFile("in.txt", []byte("input"), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			state.Flags.Dry = true
+			task := decodeTask(t, test.recipe)
+			task.Upstream(test.upstream, nil)
+			for _, instance := range task.instances() {
+				diags := instance.Apply(state)
+				if diags.HasErrors() {
+					t.Fatal(diags)
+				}
+			}
+
+			// act
+			explanations := task.Explain()
+
+			// assert
+			got := util.Map(explanations, func(explanation config.Explanation) string { return explanation.Path })
+			if fmt.Sprint(got) != fmt.Sprint(test.paths) {
+				t.Errorf("expected the explanations of %v but got %v", test.paths, got)
+			}
+
+			for _, explanation := range explanations {
+				if len(explanation.Stale) == 0 {
+					t.Fatalf("expected %s to be stale", explanation.Path)
+				}
+
+				stale := explanation.Stale[0]
+				if stale.Reason != test.reason {
+					t.Errorf(`expected "%s" but got "%s"`, test.reason, stale.Reason)
+				}
+
+				if strings.Join(stale.Dependencies, ",") != strings.Join(test.upstream, ",") {
+					t.Errorf("expected the dependencies %v but got %v", test.upstream, stale.Dependencies)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bake/internal/util"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/gocty"
@@ -23,7 +24,8 @@ func StructToCty(instance interface{}) cty.Value {
 		}
 
 		// ignore custom hcl tags :invader
-		if field.Tag.Get("hcl") == ",remain" {
+		tag := field.Tag.Get("hcl")
+		if tag == ",remain" || strings.HasSuffix(tag, ",block") {
 			continue
 		}
 
@@ -34,6 +36,12 @@ func StructToCty(instance interface{}) cty.Value {
 			continue
 		}
 
+		// values decoded as they were written
+		if v, ok := fieldInterface.(cty.Value); ok {
+			result[name] = v
+			continue
+		}
+
 		// handle primitives conversions
 		impliedType, err := gocty.ImpliedType(fieldInterface)
 		if err != nil { // should never be reached -> implies a 🐞 in the code
@@ -0,0 +1,250 @@
+package lang
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"bake/internal/lang/config"
+	"bake/internal/lang/schema"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// Variable is an input of the recipes whose value can be set from outside of them
+type Variable struct {
+	Name        string
+	Description string
+	typ         cty.Type
+	// default value; only if the variable is not required
+	value       cty.Value
+	required    bool
+	validations []validation
+	block       *hcl.Block
+}
+
+type validation struct {
+	condition    hcl.Expression
+	errorMessage hcl.Expression
+}
+
+func NewVariable(block *hcl.Block) (*Variable, hcl.Diagnostics) {
+	content, diags := block.Body.Content(schema.VariableSchema())
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	variable := &Variable{Name: block.Labels[0], typ: cty.DynamicPseudoType, required: true, block: block}
+	if attr, ok := content.Attributes[schema.DescriptionAttr]; ok {
+		diags := gohcl.DecodeExpression(attr.Expr, nil, &variable.Description)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+	}
+
+	if attr, ok := content.Attributes[schema.TypeAttr]; ok {
+		variable.typ, diags = typeexpr.TypeConstraint(attr.Expr)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+	}
+
+	if attr, ok := content.Attributes[schema.DefaultAttr]; ok {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		variable.value, diags = variable.convert(value, attr.Expr.Range().Ptr())
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		variable.required = false
+	}
+
+	for _, block := range content.Blocks {
+		content, diags := block.Body.Content(schema.ValidationSchema())
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		variable.validations = append(variable.validations, validation{
+			condition:    content.Attributes[schema.ConditionAttr].Expr,
+			errorMessage: content.Attributes[schema.ErrorAttr].Expr,
+		})
+	}
+
+	return variable, nil
+}
+
+// VariableValues decodes the value of every variable. Values are applied in order
+// such that the last one for a variable wins; otherwise its default is used
+func VariableValues(variables []*Variable, values []config.VariableValue) (map[string]cty.Value, hcl.Diagnostics) {
+	declared := map[string]*Variable{}
+	for _, variable := range variables {
+		if previous, ok := declared[variable.Name]; ok {
+			return nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf(`variable "%s" was already declared at %s`, variable.Name, previous.block.DefRange.String()),
+				Subject:  &variable.block.DefRange,
+			}}
+		}
+
+		declared[variable.Name] = variable
+	}
+
+	result := map[string]cty.Value{}
+	for _, value := range values {
+		variable, ok := declared[value.Name]
+		if !ok {
+			// env vars might be meant for other recipes
+			if strings.HasPrefix(value.Source, config.VarEnvPrefix) {
+				continue
+			}
+
+			diag := &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf(`value for undeclared variable "%s" from %s`, value.Name, value.Source),
+			}
+			if value.Expr != nil {
+				diag.Subject = value.Expr.Range().Ptr()
+			}
+
+			return nil, hcl.Diagnostics{diag}
+		}
+
+		decoded, diags := variable.decode(value)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		result[value.Name] = decoded
+	}
+
+	names := make([]string, 0, len(declared))
+	for name := range declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		variable := declared[name]
+		if _, ok := result[name]; ok {
+			continue
+		}
+
+		if variable.required {
+			return nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf(`variable "%s" is not set`, name),
+				Detail: fmt.Sprintf(`Set it with "-%s %s=value", the %s%s env var or a %s file`,
+					config.VarFlag, name, config.VarEnvPrefix, name, config.VarsFileExt),
+				Subject: &variable.block.DefRange,
+			}}
+		}
+
+		result[name] = variable.value
+	}
+
+	for _, name := range names {
+		diags := declared[name].validate(result[name])
+		if diags.HasErrors() {
+			return nil, diags
+		}
+	}
+
+	return result, nil
+}
+
+// decode the value according to the type of the variable
+func (variable Variable) decode(value config.VariableValue) (cty.Value, hcl.Diagnostics) {
+	if value.Expr != nil {
+		decoded, diags := value.Expr.Value(nil)
+		if diags.HasErrors() {
+			return cty.NilVal, diags
+		}
+
+		return variable.convert(decoded, value.Expr.Range().Ptr())
+	}
+
+	// primitive values are taken literally; complex ones are written as hcl
+	if variable.typ.Equals(cty.DynamicPseudoType) || variable.typ.IsPrimitiveType() {
+		decoded, diags := variable.convert(cty.StringVal(value.Raw), nil)
+		for _, diag := range diags {
+			diag.Detail = fmt.Sprintf("%s from %s", diag.Detail, value.Source)
+		}
+
+		return decoded, diags
+	}
+
+	expr, diags := hclsyntax.ParseExpression([]byte(value.Raw), value.Source, hcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+
+	decoded, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+
+	return variable.convert(decoded, expr.Range().Ptr())
+}
+
+func (variable Variable) convert(value cty.Value, subject *hcl.Range) (cty.Value, hcl.Diagnostics) {
+	converted, err := convert.Convert(value, variable.typ)
+	if err != nil {
+		return cty.NilVal, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`invalid value for variable "%s"`, variable.Name),
+			Detail:   err.Error(),
+			Subject:  subject,
+			Context:  &variable.block.DefRange,
+		}}
+	}
+
+	return converted, nil
+}
+
+// validate the value against every condition of the variable
+func (variable Variable) validate(value cty.Value) hcl.Diagnostics {
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			schema.VarScope: cty.ObjectVal(map[string]cty.Value{variable.Name: value}),
+		},
+		Functions: schema.Functions(),
+	}
+
+	for _, validation := range variable.validations {
+		var ok bool
+		diags := gohcl.DecodeExpression(validation.condition, ctx, &ok)
+		if diags.HasErrors() {
+			return diags
+		}
+
+		if ok {
+			continue
+		}
+
+		var message string
+		diags = gohcl.DecodeExpression(validation.errorMessage, ctx, &message)
+		if diags.HasErrors() {
+			return diags
+		}
+
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`invalid value for variable "%s"`, variable.Name),
+			Detail:   message,
+			Subject:  validation.condition.Range().Ptr(),
+			Context:  &variable.block.DefRange,
+		}}
+	}
+
+	return nil
+}
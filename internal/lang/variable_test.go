@@ -0,0 +1,211 @@
+package lang
+
+import (
+	"testing"
+
+	"bake/internal/lang/config"
+	"bake/internal/lang/schema"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const variablesRecipe = `
+variable "name" {
+  default = "world"
+}
+
+variable "port" {
+  type    = number
+  default = 8080
+
+  validation {
+    condition     = var.port > 1024
+    error_message = "privileged ports are not allowed"
+  }
+}
+
+variable "tags" {
+  type    = list(string)
+  default = []
+}
+`
+
+// decodeVariables declared by the recipe
+func decodeVariables(t *testing.T, recipe string) []*Variable {
+	t.Helper()
+	file, diags := hclparse.NewParser().ParseHCL([]byte(recipe), "main.hcl")
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	content, diags := file.Body.Content(schema.FileSchema())
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	variables := make([]*Variable, 0)
+	for _, block := range content.Blocks {
+		variable, diags := NewVariable(block)
+		if diags.HasErrors() {
+			t.Fatal(diags)
+		}
+
+		variables = append(variables, variable)
+	}
+
+	return variables
+}
+
+// fileValue as read from a vars file
+func fileValue(t *testing.T, name, expr string) config.VariableValue {
+	t.Helper()
+	parsed, diags := hclsyntax.ParseExpression([]byte(expr), "main.bakevars", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	return config.VariableValue{Name: name, Expr: parsed, Source: "main.bakevars"}
+}
+
+func TestVariableValues(t *testing.T) {
+	env := config.VariableValue{Name: "name", Raw: "env", Source: "BAKE_VAR_name"}
+	cli := config.VariableValue{Name: "name", Raw: "cli", Source: "-var"}
+	tests := []struct {
+		name   string
+		values func(t *testing.T) []config.VariableValue
+		want   map[string]cty.Value
+	}{
+		{
+			name:   "defaults",
+			values: func(t *testing.T) []config.VariableValue { return nil },
+			want:   map[string]cty.Value{"name": cty.StringVal("world"), "port": cty.NumberIntVal(8080), "tags": cty.ListValEmpty(cty.String)},
+		},
+		{
+			name:   "env",
+			values: func(t *testing.T) []config.VariableValue { return []config.VariableValue{env} },
+			want:   map[string]cty.Value{"name": cty.StringVal("env")},
+		},
+		{
+			name: "file overrides env",
+			values: func(t *testing.T) []config.VariableValue {
+				return []config.VariableValue{env, fileValue(t, "name", `"file"`)}
+			},
+			want: map[string]cty.Value{"name": cty.StringVal("file")},
+		},
+		{
+			name: "cli overrides file",
+			values: func(t *testing.T) []config.VariableValue {
+				return []config.VariableValue{env, fileValue(t, "name", `"file"`), cli}
+			},
+			want: map[string]cty.Value{"name": cty.StringVal("cli")},
+		},
+		{
+			name: "primitive from raw",
+			values: func(t *testing.T) []config.VariableValue {
+				return []config.VariableValue{{Name: "port", Raw: "3000", Source: "-var"}}
+			},
+			want: map[string]cty.Value{"port": cty.NumberIntVal(3000)},
+		},
+		{
+			name: "complex from raw",
+			values: func(t *testing.T) []config.VariableValue {
+				return []config.VariableValue{{Name: "tags", Raw: `["a", "b"]`, Source: "-var"}}
+			},
+			want: map[string]cty.Value{"tags": cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")})},
+		},
+		{
+			name: "undeclared from env",
+			values: func(t *testing.T) []config.VariableValue {
+				return []config.VariableValue{{Name: "other", Raw: "1", Source: "BAKE_VAR_other"}}
+			},
+			want: map[string]cty.Value{"name": cty.StringVal("world")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			variables := decodeVariables(t, variablesRecipe)
+
+			// act
+			got, diags := VariableValues(variables, test.values(t))
+
+			// assert
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			for name, want := range test.want {
+				if !got[name].Equals(want).True() {
+					t.Errorf("expected %s = %#v but got %#v", name, want, got[name])
+				}
+			}
+		})
+	}
+}
+
+func TestVariableValuesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		recipe  string
+		values  []config.VariableValue
+		summary string
+		detail  string
+	}{
+		{
+			name:    "not a number",
+			recipe:  variablesRecipe,
+			values:  []config.VariableValue{{Name: "port", Raw: "http", Source: "-var"}},
+			summary: `invalid value for variable "port"`,
+		},
+		{
+			name:    "validation",
+			recipe:  variablesRecipe,
+			values:  []config.VariableValue{{Name: "port", Raw: "80", Source: "-var"}},
+			summary: `invalid value for variable "port"`,
+			detail:  "privileged ports are not allowed",
+		},
+		{
+			name:    "undeclared from cli",
+			recipe:  variablesRecipe,
+			values:  []config.VariableValue{{Name: "other", Raw: "1", Source: "-var"}},
+			summary: `value for undeclared variable "other" from -var`,
+		},
+		{
+			name:    "required",
+			recipe:  `variable "token" {}`,
+			summary: `variable "token" is not set`,
+		},
+		{
+			name:    "declared twice",
+			recipe:  "variable \"token\" {}\nvariable \"token\" {}",
+			summary: `variable "token" was already declared at main.hcl:1,1-17`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			variables := decodeVariables(t, test.recipe)
+
+			// act
+			_, diags := VariableValues(variables, test.values)
+
+			// assert
+			if !diags.HasErrors() {
+				t.Fatal("expected an error diagnostic")
+			}
+
+			if diags[0].Summary != test.summary {
+				t.Errorf(`expected "%s" but got "%s"`, test.summary, diags[0].Summary)
+			}
+
+			if test.detail != "" && diags[0].Detail != test.detail {
+				t.Errorf(`expected "%s" but got "%s"`, test.detail, diags[0].Detail)
+			}
+		})
+	}
+}
@@ -2,14 +2,22 @@ package module
 
 import (
 	"bake/internal/concurrent"
+	"bake/internal/event"
 	"bake/internal/lang/config"
+	"bake/internal/lang/schema"
 	"bake/internal/module/topo"
+	"bake/internal/paths"
+	"bake/internal/util"
 	"fmt"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
 )
 
 // example from make target --dry-run --debug
@@ -65,8 +73,9 @@ Successfully remade target file 'dev'.
 
 // Coordinator executes tasks in parallel respecting the dependencies between each task
 type Coordinator struct {
-	waiting *concurrent.Map[config.Address, *sync.WaitGroup]
-	actions *concurrent.Slice[config.Action]
+	waiting  *concurrent.Map[config.Address, *sync.WaitGroup]
+	actions  *concurrent.Slice[config.Action]
+	selected []cty.Path
 }
 
 func NewCoordinator() Coordinator {
@@ -80,44 +89,248 @@ func NewCoordinator() Coordinator {
 // have a previously registered task, otherwise the entire task coordinator
 // is stopped and an error is returned
 func (coordinator *Coordinator) Do(state *config.State, task config.RawAddress, addresses []config.RawAddress) ([]config.Action, hcl.Diagnostics) {
-	allDependencies, diags := topo.AllDependencies(task, addresses)
-	if diags.HasErrors() {
-		return nil, diags
+	return coordinator.DoAll(state, []config.RawAddress{task}, addresses)
+}
+
+// DoAll tasks as a single run such that the dependencies they share are only applied once
+func (coordinator *Coordinator) DoAll(state *config.State, tasks []config.RawAddress, addresses []config.RawAddress) ([]config.Action, hcl.Diagnostics) {
+	// each dependency list is sorted so appending the missing ones keeps the order valid
+	order := make([]config.RawAddress, 0)
+	allDependencies := map[string][]config.RawAddress{}
+	for _, task := range tasks {
+		taskDependencies, diags := topo.AllDependencies(task, addresses)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		for _, address := range taskDependencies[config.AddressToString(task)] {
+			name := config.AddressToString(address)
+			if _, ok := allDependencies[name]; !ok {
+				allDependencies[name] = taskDependencies[name]
+				order = append(order, address)
+			}
+		}
 	}
 
-	taskDependencies := allDependencies[config.AddressToString(task)]
-	for _, address := range taskDependencies {
+	var diags hcl.Diagnostics
+	applied := make([]config.Address, 0)
+	skipped := make([]config.Address, 0)
+	for _, address := range order {
 		// get the dependencies of this task dependency
 		addressDependencies := allDependencies[config.AddressToString(address)]
 		// wait for all routines to finish so that we get all actions
 		// we need to remove the last element since it is the address itself
+		log := state.Events.Logger(config.AddressToString(address))
+		waiting := time.Now()
 		diags := coordinator.waitFor(addressDependencies[:len(addressDependencies)-1])
 		if diags.HasErrors() {
 			return nil, diags
 		}
 
+		log.Span(event.Wait, waiting, 0)
+
+		// dependencies are transitive so we only need to check them directly
+		if failedAny(state, addressDependencies[:len(addressDependencies)-1]) {
+			state.Events.Publish(event.Event{
+				Kind:   event.TaskPlanned,
+				Task:   config.AddressToString(address),
+				Reason: "a dependency failed ... skipping",
+			})
+			coordinator.waiting.Put(address, nil)
+			skipped = append(skipped, address)
+			continue
+		}
+
 		evalContext := state.EvalContext()
 		evalContext.Variables = concurrent.Merge(
 			pathEvalContext(state, address),
 			config.Actions(coordinator.actions.Items()).EvalContext(),
 		)
+		decoding := time.Now()
 		action, diags := address.Decode(evalContext)
 		if diags.HasErrors() {
 			return nil, diags
 		}
 
+		// the requested instance might depend on other values, ex: count = var.workers
+		if state.Instance != nil && state.Instance[:len(state.Instance)-1].Equals(address.GetPath()) {
+			diags := config.CheckInstance(state.Instance, action.CTY(), nil)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+		}
+
+		state.Events.Publish(event.Event{
+			Kind:         event.Span,
+			Task:         config.AddressToString(address),
+			Time:         decoding,
+			Duration:     time.Since(decoding),
+			Phase:        event.Decode,
+			Dependencies: explicitDependencies(address),
+		})
+
+		// let the action know which of its dependencies changed their outputs
+		if dependent, ok := action.(config.Dependent); ok {
+			changed, outputs, diags := coordinator.changedUpstream(address)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+
+			dependent.Upstream(changed, outputs)
+		}
+
+		// decode but don't apply tasks outside of the selection so that others can still refer to them
+		if !coordinator.isSelected(address) {
+			coordinator.waiting.Put(address, nil)
+			coordinator.actions.Append(action)
+			continue
+		}
+
 		wait := action.Apply(state)
 		// initialize this dependency wait group so that other goroutines can wait for it
 		coordinator.waiting.Put(address, wait)
 		coordinator.actions.Append(action)
+		if wait != nil {
+			applied = append(applied, address)
+		}
 	}
 
 	err := state.Group.Wait()
 	if diags, ok := err.(hcl.Diagnostics); ok {
-		return nil, diags
+		// return the actions anyway so that those that succeeded are not lost
+		return coordinator.actions.Items(), diags
+	}
+
+	failures := state.Failures.Items()
+	if len(failures) == 0 {
+		return coordinator.actions.Items(), nil
+	}
+
+	for _, failure := range failures {
+		diags = diags.Extend(failure.Diagnostics)
+	}
+
+	return coordinator.actions.Items(), diags.Append(summary(state, applied, skipped))
+}
+
+// explicitDependencies of address; if any
+func explicitDependencies(address config.RawAddress) []string {
+	explicit, ok := address.(config.ExplicitDependencies)
+	if !ok {
+		return nil
+	}
+
+	traversals, diags := explicit.DependsOn()
+	if diags.HasErrors() {
+		return nil
+	}
+
+	return util.Map(traversals, func(traversal hcl.Traversal) string {
+		return paths.String(paths.FromTraversal(traversal))
+	})
+}
+
+func failedAny(state *config.State, addresses []config.RawAddress) bool {
+	for _, address := range addresses {
+		if state.Failed(address.GetPath()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// summary of a run that kept going after some failures
+func summary(state *config.State, applied, skipped []config.Address) *hcl.Diagnostic {
+	succeeded := make([]string, 0)
+	for _, address := range applied {
+		if !state.Failed(address.GetPath()) {
+			succeeded = append(succeeded, config.AddressToString(address))
+		}
+	}
+
+	failed := make([]string, 0)
+	for _, failure := range state.Failures.Items() {
+		failed = append(failed, paths.String(failure.Path))
+	}
+
+	sort.Strings(failed)
+	// the failures are already reported as errors
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary: fmt.Sprintf("%d succeeded, %d failed and %d skipped",
+			len(succeeded), len(failed), len(skipped)),
+		Detail: fmt.Sprintf("succeeded: %s\nfailed: %s\nskipped: %s",
+			strings.Join(succeeded, ", "),
+			strings.Join(failed, ", "),
+			strings.Join(util.Map(skipped, config.AddressToString[config.Address]), ", "),
+		),
+	}
+}
+
+// changedUpstream returns the explicit dependencies of address that changed their outputs
+// together with the digest of the outputs of their instances. It fails if any of them refers
+// to an instance that its dependency doesn't declare. All dependencies MUST be already applied
+func (coordinator *Coordinator) changedUpstream(address config.RawAddress) ([]string, map[string]string, hcl.Diagnostics) {
+	explicit, ok := address.(config.ExplicitDependencies)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	traversals, diags := explicit.DependsOn()
+	if diags.HasErrors() {
+		return nil, nil, diags
+	}
+
+	changed := make([]string, 0)
+	outputs := map[string]string{}
+	for _, traversal := range traversals {
+		path := paths.FromTraversal(traversal)
+		for _, action := range coordinator.actions.Items() {
+			if !path.HasPrefix(action.GetPath()) {
+				continue
+			}
+
+			if len(path) > len(action.GetPath()) {
+				diags := config.CheckInstance(path[:len(action.GetPath())+1], action.CTY(), traversal.SourceRange().Ptr())
+				if diags.HasErrors() {
+					return nil, nil, diags
+				}
+			}
+
+			changer, ok := action.(config.Changer)
+			if !ok {
+				continue
+			}
+
+			maps.Copy(outputs, changer.Outputs(path))
+			if changer.Changed(path) {
+				changed = append(changed, paths.String(path))
+			}
+		}
+	}
+
+	return changed, outputs, nil
+}
+
+// Select restricts the tasks applied by the coordinator to those with the provided paths.
+// Data and locals are always applied since tasks might depend on their values
+func (coordinator *Coordinator) Select(paths ...cty.Path) {
+	coordinator.selected = paths
+}
+
+func (coordinator *Coordinator) isSelected(address config.Address) bool {
+	if coordinator.selected == nil || schema.IsKnownPrefix(address.GetPath()) {
+		return true
+	}
+
+	for _, path := range coordinator.selected {
+		if path.Equals(address.GetPath()) {
+			return true
+		}
 	}
 
-	return coordinator.actions.Items(), nil
+	return false
 }
 
 func (coordinator *Coordinator) waitFor(dependencies []config.RawAddress) hcl.Diagnostics {
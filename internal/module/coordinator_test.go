@@ -2,16 +2,20 @@ package module
 
 import (
 	"bake/internal/lang/config"
+	"bake/internal/paths"
 	"bake/internal/util"
 	"context"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
 )
 
 const tolerance = 0.01
@@ -175,3 +179,225 @@ func TestCustomCoordination(t *testing.T) {
 		t.Errorf("expected around 0.8 seconds but got %f", duration.Seconds())
 	}
 }
+
+// fakeChanger changed the outputs of the instances with the given paths
+type fakeChanger struct {
+	fakeAddress
+	changed []cty.Path
+}
+
+func (s fakeChanger) Changed(path cty.Path) bool {
+	for _, changed := range s.changed {
+		if changed.HasPrefix(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CTY of the two instances of the changer, ex: count = 2
+func (s fakeChanger) CTY() cty.Value {
+	return cty.TupleVal([]cty.Value{cty.StringVal(s.name), cty.StringVal(s.name)})
+}
+
+// Outputs of the changed instances; the digest is their name
+func (s fakeChanger) Outputs(path cty.Path) map[string]string {
+	result := map[string]string{}
+	for _, changed := range s.changed {
+		if changed.HasPrefix(path) {
+			result[paths.String(changed)] = paths.String(changed)
+		}
+	}
+
+	return result
+}
+
+// fakeDependent explicitly depends on the given traversals
+type fakeDependent struct {
+	fakeAddress
+	dependsOn []hcl.Traversal
+}
+
+func (s fakeDependent) DependsOn() ([]hcl.Traversal, hcl.Diagnostics) {
+	return s.dependsOn, nil
+}
+
+func TestChangedUpstream(t *testing.T) {
+	gen := hcl.Traversal{hcl.TraverseRoot{Name: "gen"}}
+	first := hcl.Traversal{hcl.TraverseRoot{Name: "gen"}, hcl.TraverseIndex{Key: cty.NumberIntVal(0)}}
+	second := hcl.Traversal{hcl.TraverseRoot{Name: "gen"}, hcl.TraverseIndex{Key: cty.NumberIntVal(1)}}
+	missing := hcl.Traversal{hcl.TraverseRoot{Name: "gen"}, hcl.TraverseIndex{Key: cty.NumberIntVal(7)}}
+	named := hcl.Traversal{hcl.TraverseRoot{Name: "gen"}, hcl.TraverseIndex{Key: cty.StringVal("x")}}
+	tests := []struct {
+		name      string
+		changed   []cty.Path
+		dependsOn []hcl.Traversal
+		want      []string
+		outputs   []string
+		summary   string
+	}{
+		{name: "nothing changed", changed: nil, dependsOn: []hcl.Traversal{gen}, want: []string{}, outputs: []string{}},
+		{name: "any instance changed", changed: []cty.Path{cty.GetAttrPath("gen").IndexInt(0)}, dependsOn: []hcl.Traversal{gen}, want: []string{"gen"}, outputs: []string{"gen[0]"}},
+		{name: "referred instance changed", changed: []cty.Path{cty.GetAttrPath("gen").IndexInt(0)}, dependsOn: []hcl.Traversal{first}, want: []string{"gen[0]"}, outputs: []string{"gen[0]"}},
+		{name: "other instance changed", changed: []cty.Path{cty.GetAttrPath("gen").IndexInt(0)}, dependsOn: []hcl.Traversal{second}, want: []string{}, outputs: []string{}},
+		{name: "out of range instance", dependsOn: []hcl.Traversal{missing}, summary: `couldn't find any instance with name gen[7]. Did you mean "gen[0]"`},
+		{name: "named instance", dependsOn: []hcl.Traversal{named}, summary: `couldn't find any instance with name gen["x"]. Did you mean "gen[0]"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			coordinator := NewCoordinator()
+			coordinator.actions.Append(fakeChanger{fakeAddress{"gen", nil}, test.changed})
+			coordinator.actions.Append(fakeAddress{"other", nil})
+			dependent := fakeDependent{fakeAddress{"build", []string{"gen"}}, test.dependsOn}
+
+			// act
+			changed, outputs, diags := coordinator.changedUpstream(dependent)
+
+			// assert
+			if test.summary != "" {
+				if !diags.HasErrors() || diags[0].Summary != test.summary {
+					t.Errorf(`expected "%s" but got %s`, test.summary, diags)
+				}
+
+				return
+			}
+
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			if fmt.Sprint(changed) != fmt.Sprint(test.want) {
+				t.Errorf("expected %v but got %v", test.want, changed)
+			}
+
+			got := maps.Keys(outputs)
+			sort.Strings(got)
+			if fmt.Sprint(got) != fmt.Sprint(test.outputs) {
+				t.Errorf("expected the outputs of %v but got %v", test.outputs, got)
+			}
+		})
+	}
+}
+
+// fakeFailure fails as if the run kept going
+type fakeFailure struct {
+	fakeAddress
+}
+
+func (s fakeFailure) Decode(ctx *hcl.EvalContext) (config.Action, hcl.Diagnostics) {
+	return s, nil
+}
+
+func (s fakeFailure) Apply(state *config.State) *sync.WaitGroup {
+	wait := &sync.WaitGroup{}
+	wait.Add(1)
+	state.Group.Go(func() error {
+		defer wait.Done()
+		state.Failures.Append(config.Failure{Path: s.GetPath(), Diagnostics: hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf(`"%s" failed`, s.name),
+		}}})
+
+		return nil
+	})
+
+	return wait
+}
+
+func TestKeepGoingCoordination(t *testing.T) {
+	// arrange
+	addresses := []config.RawAddress{
+		fakeFailure{fakeAddress{"1", nil}},
+		fakeAddress{"2", []string{"1"}},
+		fakeAddress{"3", nil},
+		fakeAddress{"4", []string{"2", "3"}},
+	}
+
+	state, err := config.NewState(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state.Flags.KeepGoing = true
+	coordinator := NewCoordinator()
+
+	// act
+	_, diags := coordinator.Do(state, addresses[len(addresses)-1], addresses)
+
+	// assert
+	if !diags.HasErrors() {
+		t.Fatal("expected the failure to be reported")
+	}
+
+	if diags[0].Summary != `"1" failed` {
+		t.Errorf(`expected the failure of "1" but got %s`, diags[0].Summary)
+	}
+
+	summary := diags[len(diags)-1]
+	if summary.Severity != hcl.DiagWarning {
+		t.Errorf("expected the summary to be a warning")
+	}
+
+	if summary.Summary != "1 succeeded, 1 failed and 2 skipped" {
+		t.Errorf("unexpected summary %s", summary.Summary)
+	}
+
+	if summary.Detail != "succeeded: 3\nfailed: 1\nskipped: 2, 4" {
+		t.Errorf("unexpected detail %s", summary.Detail)
+	}
+
+	if !failedAny(state, addresses[:1]) || failedAny(state, addresses[1:]) {
+		t.Errorf(`expected only "1" to fail`)
+	}
+}
+
+// fakeCounted counts how many times it was applied
+type fakeCounted struct {
+	fakeAddress
+	applied *int32
+}
+
+func (s fakeCounted) Decode(ctx *hcl.EvalContext) (config.Action, hcl.Diagnostics) {
+	return s, nil
+}
+
+func (s fakeCounted) Apply(state *config.State) *sync.WaitGroup {
+	atomic.AddInt32(s.applied, 1)
+	return s.fakeAddress.Apply(state)
+}
+
+func TestAllCoordination(t *testing.T) {
+	// arrange
+	var applied int32
+	addresses := []config.RawAddress{
+		fakeCounted{fakeAddress{"1", nil}, &applied},
+		fakeAddress{"2", []string{"1"}},
+		fakeAddress{"3", []string{"1"}},
+	}
+
+	state, err := config.NewState(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coordinator := NewCoordinator()
+
+	// act
+	actions, diags := coordinator.DoAll(state, addresses[1:], addresses)
+
+	// assert
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	if applied != 1 {
+		t.Errorf("expected the shared dependency to be applied once but got %d", applied)
+	}
+
+	if len(actions) != 3 {
+		t.Errorf("expected 3 actions but got %d", len(actions))
+	}
+}
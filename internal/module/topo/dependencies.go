@@ -114,12 +114,55 @@ func visit(current string, markers map[string]marker, addresses map[string]confi
 	return order, nil
 }
 
+// Resolve the addresses referenced by traversals; without duplicates and ignoring
+// those automatically injected by bake
+func Resolve(traversals []hcl.Traversal, addresses []config.RawAddress) ([]config.RawAddress, hcl.Diagnostics) {
+	mapping := map[string]config.RawAddress{}
+	for _, address := range addresses {
+		mapping[config.AddressToString(address)] = address
+	}
+
+	seen := map[string]bool{}
+	result := make([]config.RawAddress, 0)
+	for _, traversal := range traversals {
+		if ignoreRef(traversal) {
+			continue
+		}
+
+		address, diags := getByPrefix(traversal, mapping)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		name := config.AddressToString(address)
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		result = append(result, address)
+	}
+
+	return result, nil
+}
+
 func getByPrefix(traversal hcl.Traversal, addresses map[string]config.RawAddress) (config.RawAddress, hcl.Diagnostics) {
 	path := paths.FromTraversal(traversal)
 	for _, address := range addresses {
-		if path.HasPrefix(address.GetPath()) {
-			return address, nil
+		if !path.HasPrefix(address.GetPath()) {
+			continue
+		}
+
+		// refer to an instance, ex: depends_on = [gen[1]]
+		instances, ok := address.(config.Instances)
+		if ok && len(path) > len(address.GetPath()) {
+			diags := config.CheckInstance(path[:len(address.GetPath())+1], instances.Instances(), traversal.SourceRange().Ptr())
+			if diags.HasErrors() {
+				return nil, diags
+			}
 		}
+
+		return address, nil
 	}
 
 	options := util.Map(maps.Values(addresses), config.AddressToString[config.RawAddress])
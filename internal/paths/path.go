@@ -2,6 +2,7 @@ package paths
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/zclconf/go-cty/cty"
@@ -48,7 +49,8 @@ func StepString(step cty.PathStep) string {
 	case cty.IndexStep:
 		switch ss.Key.Type() {
 		case cty.Number:
-			return fmt.Sprintf(`[%d]`, ss.Key.AsBigFloat())
+			index, _ := ss.Key.AsBigFloat().Int64()
+			return fmt.Sprintf(`[%d]`, index)
 		case cty.String:
 			return fmt.Sprintf(`["%s"]`, ss.Key.AsString())
 		}
@@ -57,3 +59,13 @@ func StepString(step cty.PathStep) string {
 	// maybe go-cty added a new step type?
 	panic("key value not number or string")
 }
+
+// InstanceOf returns the address of the block that created the instance with name, ex: build[0] -> build
+func InstanceOf(name string) string {
+	index := strings.Index(name, "[")
+	if index < 0 {
+		return name
+	}
+
+	return name[:index]
+}
@@ -0,0 +1,79 @@
+package paths
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestInstanceOf(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "build", want: "build"},
+		{name: "build[0]", want: "build"},
+		{name: `build["linux"]`, want: "build"},
+		{name: "data.version", want: "data.version"},
+		{name: "module.app.build[1]", want: "module.app.build"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// act
+			got := InstanceOf(test.name)
+
+			// assert
+			if got != test.want {
+				t.Errorf(`expected "%s" but got "%s"`, test.want, got)
+			}
+		})
+	}
+}
+
+func TestStepString(t *testing.T) {
+	tests := []struct {
+		name string
+		step cty.PathStep
+		want string
+	}{
+		{name: "attribute", step: cty.GetAttrStep{Name: "build"}, want: "build"},
+		{name: "index", step: cty.IndexStep{Key: cty.NumberIntVal(2)}, want: "[2]"},
+		{name: "key", step: cty.IndexStep{Key: cty.StringVal("linux")}, want: `["linux"]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// act
+			got := StepString(test.step)
+
+			// assert
+			if got != test.want {
+				t.Errorf(`expected "%s" but got "%s"`, test.want, got)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		path cty.Path
+		want string
+	}{
+		{path: cty.GetAttrPath("build"), want: "build"},
+		{path: cty.GetAttrPath("build").IndexInt(0), want: "build[0]"},
+		{path: cty.GetAttrPath("data").GetAttr("version").IndexString("linux"), want: `data.version["linux"]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			// act
+			got := String(test.path)
+
+			// assert
+			if got != test.want {
+				t.Errorf(`expected "%s" but got "%s"`, test.want, got)
+			}
+		})
+	}
+}
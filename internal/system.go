@@ -4,15 +4,20 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"time"
 
+	"bake/internal/event"
 	"bake/internal/lang"
 	"bake/internal/lang/config"
 	"bake/internal/lang/schema"
 	"bake/internal/module"
+	"bake/internal/paths"
 	"bake/internal/util"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
 )
 
 func GetPublicTasks(state *config.State, parser *hclparse.Parser) ([]lang.CliCommand, error) {
@@ -25,22 +30,46 @@ func GetPublicTasks(state *config.State, parser *hclparse.Parser) ([]lang.CliCom
 	return lang.FilterPublicTasks(addrs), nil
 }
 
+// Do runs the task and publishes the lifecycle of the run; including its diagnostics
 func Do(taskName string, state *config.State, parser *hclparse.Parser) hcl.Diagnostics {
+	start := time.Now()
+	state.Events.Publish(event.Event{Kind: event.RunStarted, Task: taskName})
+	diags := do(taskName, state, parser)
+	if len(diags) > 0 {
+		state.Events.Publish(event.Event{Kind: event.Diagnostics, Task: taskName, Diagnostics: diags})
+	}
+
+	state.Events.Publish(event.Event{
+		Kind:     event.RunFinished,
+		Task:     taskName,
+		Duration: time.Since(start),
+		Success:  !diags.HasErrors(),
+	})
+	return diags
+}
+
+func do(taskName string, state *config.State, parser *hclparse.Parser) hcl.Diagnostics {
 	// read bake files in the cwd
 	addrs, diags := readRecipes(state, parser)
 	if diags.HasErrors() {
 		return diags
 	}
 
-	task, diags := getTask(taskName, addrs)
+	task, instance, diags := getInstance(taskName, addrs)
 	if diags.HasErrors() {
 		return diags
 	}
 
-	coordinator := module.NewCoordinator()
-	actions, diags := coordinator.Do(state, task, addrs)
+	state.Instance = instance
+	_, diags = apply(state, []config.RawAddress{task}, addrs, module.NewCoordinator())
+	return diags
+}
+
+// apply runs the tasks through the coordinator and stores the resulting state
+func apply(state *config.State, tasks []config.RawAddress, addrs []config.RawAddress, coordinator module.Coordinator) ([]config.Action, hcl.Diagnostics) {
+	actions, diags := coordinator.DoAll(state, tasks, addrs)
 	if state.Flags.Dry || state.Flags.Prune {
-		return diags
+		return actions, diags
 	}
 
 	for _, action := range actions {
@@ -49,53 +78,193 @@ func Do(taskName string, state *config.State, parser *hclparse.Parser) hcl.Diagn
 
 	err := state.Lock.Store(state.CWD)
 	if err != nil {
-		diags.Append(&hcl.Diagnostic{
+		diags = diags.Append(&hcl.Diagnostic{
 			Severity: hcl.DiagError,
 			Summary:  "error storing state",
 			Detail:   err.Error(),
 		})
 	}
 
-	return diags
+	return actions, diags
 }
 
 func readRecipes(state *config.State, parser *hclparse.Parser) ([]config.RawAddress, hcl.Diagnostics) {
-	files, err := ioutil.ReadDir(state.CWD)
+	// values from env vars are overridden by those from files and those by the ones from the cli
+	recipes := &recipes{values: config.VariablesFromEnv(config.Env())}
+	diags := recipes.read(state, parser, lang.NewRootModule(state.CWD), map[string]bool{})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	values := append(recipes.values, state.VarFlags...)
+	variableValues, diags := lang.VariableValues(recipes.variables, values)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	state.Variables = variableValues
+
+	return recipes.addresses, nil
+}
+
+type recipes struct {
+	addresses []config.RawAddress
+	variables []*lang.Variable
+	values    []config.VariableValue
+}
+
+// read the recipes of module together with those of the modules declared by them. Variables
+// are shared by all modules but their values can only be set by the vars files of the root recipes
+func (recipes *recipes) read(state *config.State, parser *hclparse.Parser, module *lang.Module, parents map[string]bool) hcl.Diagnostics {
+	dir := module.Dir
+	files, err := ioutil.ReadDir(filepath.Join(state.CWD, dir))
 	if err != nil {
-		return nil, hcl.Diagnostics{{
+		return hcl.Diagnostics{{
 			Severity: hcl.DiagError,
-			Summary:  "couldn't read files in " + state.CWD,
+			Summary:  "couldn't read files in " + filepath.Join(state.CWD, dir),
 			Detail:   err.Error(),
 		}}
 	}
 
-	addresses := make([]config.RawAddress, 0)
-	for _, filename := range files {
-		if filepath.Ext(filename.Name()) != ".hcl" { // todo: change to .rcp
+	parents[filepath.Clean(dir)] = true
+	defer delete(parents, filepath.Clean(dir))
+	modules := map[string]*hcl.Block{}
+	for _, file := range files {
+		filename := filepath.Join(dir, file.Name())
+		if filepath.Ext(filename) == config.VarsFileExt && module.IsRoot() {
+			fileValues, diags := readVariables(filename, parser)
+			if diags.HasErrors() {
+				return diags
+			}
+
+			recipes.values = append(recipes.values, fileValues...)
+			continue
+		}
+
+		if filepath.Ext(filename) != ".hcl" { // todo: change to .rcp
 			continue
 		}
 
 		// read the file but don't decode it yet
-		f, diags := parser.ParseHCLFile(filename.Name())
+		f, diags := parser.ParseHCLFile(filename)
 		if diags.HasErrors() {
-			return nil, diags
+			return diags
 		}
 
 		content, diags := f.Body.Content(schema.FileSchema())
 		if diags.HasErrors() {
-			return nil, diags
+			return diags
+		}
+
+		if attr, ok := content.Attributes[schema.InterpreterAttr]; ok {
+			diags := module.SetInterpreter(attr)
+			if diags.HasErrors() {
+				return diags
+			}
 		}
 
 		for _, block := range content.Blocks {
-			address, diagnostics := lang.NewPartialAddress(block)
-			if diagnostics.HasErrors() {
-				return nil, diagnostics
+			switch block.Type {
+			case schema.VariableLabel:
+				variable, diagnostics := lang.NewVariable(block)
+				if diagnostics.HasErrors() {
+					return diagnostics
+				}
+
+				recipes.variables = append(recipes.variables, variable)
+			case schema.ModuleLabel:
+				name := block.Labels[0]
+				if previous, ok := modules[name]; ok {
+					return hcl.Diagnostics{{
+						Severity: hcl.DiagError,
+						Summary:  fmt.Sprintf(`module "%s" was already declared at %s`, name, previous.DefRange.String()),
+						Subject:  &block.DefRange,
+					}}
+				}
+
+				modules[name] = block
+				child, diagnostics := lang.NewModule(block, module)
+				if diagnostics.HasErrors() {
+					return diagnostics
+				}
+
+				if parents[filepath.Clean(child.Dir)] {
+					return hcl.Diagnostics{{
+						Severity: hcl.DiagError,
+						Summary:  fmt.Sprintf(`module "%s" includes itself`, name),
+						Detail:   fmt.Sprintf(`"%s" is the directory of one of its parents`, child.Dir),
+						Subject:  &block.DefRange,
+					}}
+				}
+
+				diagnostics = recipes.read(state, parser, child, parents)
+				if diagnostics.HasErrors() {
+					return diagnostics
+				}
+			default:
+				address, diagnostics := lang.NewPartialAddress(block, module)
+				if diagnostics.HasErrors() {
+					return diagnostics
+				}
+
+				recipes.addresses = append(recipes.addresses, address...)
 			}
-			addresses = append(addresses, address...)
 		}
 	}
 
-	return addresses, nil
+	return nil
+}
+
+// readVariables returns the values of the variables set by a vars file
+func readVariables(filename string, parser *hclparse.Parser) ([]config.VariableValue, hcl.Diagnostics) {
+	f, diags := parser.ParseHCLFile(filename)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	attributes, diags := f.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	values := make([]config.VariableValue, 0, len(attributes))
+	for name, attribute := range attributes {
+		values = append(values, config.VariableValue{Name: name, Expr: attribute.Expr, Source: filename})
+	}
+
+	return values, nil
+}
+
+// getInstance returns the task of an instance name, ex: build[0], together with the
+// path of the instance. The path is nil if name refers to the whole task. It fails if
+// the task doesn't declare the instance, ex: build[5] with count = 2
+func getInstance(name string, addresses []config.RawAddress) (config.RawAddress, cty.Path, hcl.Diagnostics) {
+	traversal, diags := hclsyntax.ParseTraversalAbs([]byte(name), "", hcl.InitialPos)
+	if diags.HasErrors() || len(traversal) < 2 {
+		task, diags := getTask(name, addresses)
+		return task, nil, diags
+	}
+
+	if _, ok := traversal[len(traversal)-1].(hcl.TraverseIndex); !ok {
+		task, diags := getTask(name, addresses)
+		return task, nil, diags
+	}
+
+	path := paths.FromTraversal(traversal)
+	task, diags := getTask(paths.String(path[:len(path)-1]), addresses)
+	if diags.HasErrors() {
+		return nil, nil, diags
+	}
+
+	// instances that depend on other values are checked once decoded; see module.Coordinator
+	if instances, ok := task.(config.Instances); ok {
+		diags = config.CheckInstance(path, instances.Instances(), nil)
+		if diags.HasErrors() {
+			return nil, nil, diags
+		}
+	}
+
+	return task, path, nil
 }
 
 func getTask(name string, addresses []config.RawAddress) (config.RawAddress, hcl.Diagnostics) {
@@ -0,0 +1,279 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"bake/internal/lang"
+	"bake/internal/lang/config"
+	"bake/internal/lang/schema"
+	"bake/internal/paths"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+func TestGetInstance(t *testing.T) {
+	recipe := `
+data "version" {
+  command = "echo 1.0"
+}
+
+task "build" {
+  count   = 2
+  command = "echo ${count.index}"
+}
+`
+	tests := []struct {
+		name     string
+		task     string
+		instance string
+		summary  string
+	}{
+		{name: "build", task: "build"},
+		{name: "build[1]", task: "build", instance: "build[1]"},
+		{name: `build["linux"]`, summary: `couldn't find any instance with name build["linux"]. Did you mean "build[0]"`},
+		{name: "build[5]", summary: `couldn't find any instance with name build[5]. Did you mean "build[0]"`},
+		{name: "data.version[0]", summary: `couldn't find any instance with name data.version[0]. Did you mean "data.version"`},
+		{name: "data.version", task: "data.version"},
+		{name: "unknown[0]", summary: "couldn't find any target with name unknown"},
+		{name: "buld", summary: `couldn't find any target with name buld. Did you mean "build"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			addresses := decodeAddresses(t, recipe)
+
+			// act
+			task, instance, diags := getInstance(test.name, addresses)
+
+			// assert
+			if test.summary != "" {
+				if !diags.HasErrors() || diags[0].Summary != test.summary {
+					t.Errorf(`expected "%s" but got %s`, test.summary, diags)
+				}
+
+				return
+			}
+
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+
+			if config.AddressToString(task) != test.task {
+				t.Errorf(`expected task "%s" but got "%s"`, test.task, config.AddressToString(task))
+			}
+
+			if paths.String(instance) != test.instance {
+				t.Errorf(`expected instance "%s" but got "%s"`, test.instance, paths.String(instance))
+			}
+		})
+	}
+}
+
+// decodeAddresses declared by the recipe; as part of the root recipes
+func decodeAddresses(t *testing.T, recipe string) []config.RawAddress {
+	t.Helper()
+	file, diags := hclparse.NewParser().ParseHCL([]byte(recipe), "main.hcl")
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	content, diags := file.Body.Content(schema.FileSchema())
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	addresses := make([]config.RawAddress, 0)
+	for _, block := range content.Blocks {
+		partial, diags := lang.NewPartialAddress(block, lang.NewRootModule(t.TempDir()))
+		if diags.HasErrors() {
+			t.Fatal(diags)
+		}
+
+		addresses = append(addresses, partial...)
+	}
+
+	return addresses
+}
+
+// run the task as a new invocation of bake in the current directory
+func run(t *testing.T, task string) {
+	t.Helper()
+	state, err := config.NewState(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diags := Do(task, state, hclparse.NewParser())
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+}
+
+// write the files into the current directory
+func write(t *testing.T, files map[string]string) {
+	t.Helper()
+	for filename, content := range files {
+		err := os.WriteFile(filename, []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(previous)
+	})
+}
+
+func TestUpstreamAcrossRuns(t *testing.T) {
+	recipe := `
+task "gen" {
+  count   = 2
+  command = "cat input.txt > gen${count.index}.txt"
+  sources = ["input.txt"]
+  creates = ["gen${count.index}.txt"]
+}
+
+task "build" {
+  command    = "echo built >> build.log && cat gen0.txt > build.txt"
+  sources    = ["build.cfg"]
+  creates    = ["build.txt"]
+  depends_on = [gen[0]]
+}
+`
+	tests := []struct {
+		name   string
+		input  string
+		runs   int
+		output string
+	}{
+		{name: "dependency unchanged", input: "a", runs: 1, output: "a"},
+		{name: "dependency changed", input: "b", runs: 2, output: "b"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			chdir(t, t.TempDir())
+			write(t, map[string]string{"main.hcl": recipe, "input.txt": "a", "build.cfg": "release"})
+			run(t, "build")
+			write(t, map[string]string{"input.txt": test.input})
+			run(t, "gen")
+
+			// act
+			run(t, "build")
+
+			// assert
+			log, err := os.ReadFile("build.log")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if runs := strings.Count(string(log), "built"); runs != test.runs {
+				t.Errorf("expected build to run %d times but it ran %d", test.runs, runs)
+			}
+
+			output, err := os.ReadFile("build.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.TrimSpace(string(output)) != test.output {
+				t.Errorf(`expected "%s" but got "%s"`, test.output, output)
+			}
+		})
+	}
+}
+
+func TestDoUnknownInstance(t *testing.T) {
+	tests := []struct {
+		name    string
+		recipe  string
+		task    string
+		summary string
+	}{
+		{name: "depends_on", recipe: `
+task "gen" {
+  count   = 2
+  command = "echo ${count.index}"
+}
+
+task "build" {
+  command    = "echo built"
+  depends_on = [gen[7]]
+}
+`, task: "build", summary: `couldn't find any instance with name gen[7]. Did you mean "gen[0]"`},
+		{name: "depends_on a count of a local", recipe: `
+locals {
+  workers = 2
+}
+
+task "gen" {
+  count   = local.workers
+  command = "echo ${count.index}"
+}
+
+task "build" {
+  command    = "echo built"
+  depends_on = [gen[7]]
+}
+`, task: "build", summary: `couldn't find any instance with name gen[7]. Did you mean "gen[0]"`},
+		{name: "depends_on a key", recipe: `
+task "gen" {
+  count   = 2
+  command = "echo ${count.index}"
+}
+
+task "build" {
+  command    = "echo built"
+  depends_on = [gen["x"]]
+}
+`, task: "build", summary: `couldn't find any instance with name gen["x"]. Did you mean "gen[0]"`},
+		{name: "count of a local", recipe: `
+locals {
+  workers = 2
+}
+
+task "gen" {
+  count   = local.workers
+  command = "echo ${count.index}"
+}
+`, task: "gen[5]", summary: `couldn't find any instance with name gen[5]. Did you mean "gen[0]"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// arrange
+			chdir(t, t.TempDir())
+			write(t, map[string]string{"main.hcl": test.recipe})
+			state, err := config.NewState(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// act
+			diags := Do(test.task, state, hclparse.NewParser())
+
+			// assert
+			if !diags.HasErrors() || diags[0].Summary != test.summary {
+				t.Errorf(`expected "%s" but got %s`, test.summary, diags)
+			}
+		})
+	}
+}
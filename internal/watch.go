@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"bake/internal/concurrent"
+	"bake/internal/lang"
+	"bake/internal/lang/config"
+	"bake/internal/module"
+	"bake/internal/module/topo"
+	"bake/internal/watch"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+)
+
+type runResult struct {
+	actions   []config.Action
+	diags     hcl.Diagnostics
+	cancelled bool
+}
+
+// Watch runs the task and then polls the sources of all tasks it depends on. Once a change
+// is detected and no further changes arrive for an interval, only the tasks affected by the
+// changes are run again. A run in progress is cancelled as soon as new changes are detected
+func Watch(taskName string, state *config.State, parser *hclparse.Parser, interval time.Duration, log hcl.DiagnosticWriter) hcl.Diagnostics {
+	addrs, diags := readRecipes(state, parser)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	task, diags := getTask(taskName, addrs)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	allDependencies, diags := topo.AllDependencies(task, addrs)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	start := func(ctx context.Context, selection []cty.Path) <-chan runResult {
+		done := make(chan runResult, 1)
+		go func() {
+			runState, err := state.Fork(ctx)
+			if err != nil {
+				done <- runResult{diags: hcl.Diagnostics{{
+					Severity: hcl.DiagError,
+					Summary:  "error reading state",
+					Detail:   err.Error(),
+				}}}
+				return
+			}
+
+			coordinator := module.NewCoordinator()
+			coordinator.Select(selection...)
+			actions, diags := apply(runState, []config.RawAddress{task}, addrs, coordinator)
+			done <- runResult{actions, diags, ctx.Err() != nil}
+		}()
+
+		return done
+	}
+
+	// first run everything
+	result := <-start(state.Context, nil)
+	report(result, log)
+	sources := taskSources(result.actions)
+	poller, err := watch.NewPoller(state.CWD, patterns(sources))
+	if err != nil {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "error watching sources",
+			Detail:   err.Error(),
+		}}
+	}
+
+	fmt.Printf("\nwatching %d files for changes\n", poller.Len())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var running <-chan runResult
+	var cancel context.CancelFunc = func() {}
+	// files that changed since the last run started; including those of a cancelled run
+	pending := map[string]bool{}
+	inFlight := make([]string, 0)
+	for {
+		select {
+		case <-state.Context.Done():
+			cancel()
+			if running != nil {
+				<-running
+			}
+
+			return nil
+		case result := <-running:
+			running = nil
+			report(result, log)
+			if len(result.actions) > 0 {
+				sources = concurrent.Merge(sources, taskSources(result.actions))
+				poller.SetPatterns(patterns(sources))
+			}
+		case <-ticker.C:
+			changed, err := poller.Poll()
+			if err != nil {
+				cancel()
+				return hcl.Diagnostics{{
+					Severity: hcl.DiagError,
+					Summary:  "error watching sources",
+					Detail:   err.Error(),
+				}}
+			}
+
+			if len(changed) > 0 {
+				// abort the current run since its results are already outdated
+				if running != nil {
+					cancel()
+					changed = append(changed, inFlight...)
+				}
+
+				for _, filename := range changed {
+					pending[filename] = true
+				}
+				continue
+			}
+
+			// debounce: wait until nothing changed for a whole interval
+			if len(pending) == 0 {
+				continue
+			}
+
+			if running != nil {
+				<-running
+				running = nil
+			}
+
+			inFlight = maps.Keys(pending)
+			sort.Strings(inFlight)
+			pending = map[string]bool{}
+			fmt.Printf("\nchanges detected in %s\n", strings.Join(inFlight, ", "))
+			selection := affected(inFlight, sources, allDependencies)
+			if len(selection) == 0 {
+				continue
+			}
+
+			ctx, stop := context.WithCancel(state.Context)
+			cancel = stop
+			running = start(ctx, selection)
+		}
+	}
+}
+
+// taskSources returns the source patterns of each task indexed by its address
+func taskSources(actions []config.Action) map[string][]string {
+	result := map[string][]string{}
+	for _, action := range actions {
+		task, ok := action.(*lang.Task)
+		if !ok {
+			continue
+		}
+
+		result[config.AddressToString(task)] = task.Sources()
+	}
+
+	return result
+}
+
+func patterns(sources map[string][]string) []string {
+	result := make([]string, 0)
+	for _, patterns := range sources {
+		result = append(result, patterns...)
+	}
+
+	return result
+}
+
+// affected returns the paths of the tasks whose sources match any of the changed
+// files together with all the tasks that depend on them
+func affected(changed []string, sources map[string][]string, allDependencies map[string][]config.RawAddress) []cty.Path {
+	matched := map[string]bool{}
+	for name, patterns := range sources {
+		for _, pattern := range patterns {
+			for _, filename := range changed {
+				ok, _ := doublestar.Match(pattern, filename)
+				if ok {
+					matched[name] = true
+				}
+			}
+		}
+	}
+
+	result := make([]cty.Path, 0)
+	for _, dependencies := range allDependencies {
+		for _, dep := range dependencies {
+			if matched[config.AddressToString(dep)] {
+				// the address itself is the last element of its dependencies
+				result = append(result, dependencies[len(dependencies)-1].GetPath())
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+func report(result runResult, log hcl.DiagnosticWriter) {
+	// errors from cancelled runs are expected; no need to show them
+	if result.cancelled || len(result.diags) == 0 {
+		return
+	}
+
+	log.WriteDiagnostics(result.diags)
+}
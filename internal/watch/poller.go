@@ -0,0 +1,114 @@
+package watch
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"bake/internal/digest"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Poller scans the files matching a set of doublestar patterns and reports
+// which of them changed between scans
+type Poller struct {
+	cwd      string
+	patterns []string
+	files    map[string]digest.File
+}
+
+// NewPoller creates a poller for the patterns relative to cwd and takes
+// an initial snapshot of the matched files
+func NewPoller(cwd string, patterns []string) (*Poller, error) {
+	poller := &Poller{
+		cwd:      cwd,
+		patterns: patterns,
+		files:    map[string]digest.File{},
+	}
+
+	files, err := poller.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	poller.files = files
+	return poller, nil
+}
+
+// SetPatterns replaces the patterns to watch; files that are no longer matched
+// are reported as changed on the next Poll
+func (poller *Poller) SetPatterns(patterns []string) {
+	poller.patterns = patterns
+}
+
+// Len is the amount of files currently watched
+func (poller *Poller) Len() int {
+	return len(poller.files)
+}
+
+// Poll returns the files that were created, removed or whose content changed
+// since the last call
+func (poller *Poller) Poll() ([]string, error) {
+	files, err := poller.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make([]string, 0)
+	for name, current := range files {
+		previous, ok := poller.files[name]
+		if !ok || previous.Digest != current.Digest {
+			changed = append(changed, name)
+		}
+	}
+
+	for name := range poller.files {
+		if _, ok := files[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+
+	poller.files = files
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func (poller *Poller) scan() (map[string]digest.File, error) {
+	FS := os.DirFS(poller.cwd)
+	files := map[string]digest.File{}
+	for _, pattern := range poller.patterns {
+		matches, err := doublestar.Glob(FS, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range matches {
+			if _, ok := files[name]; ok {
+				continue
+			}
+
+			info, err := fs.Stat(FS, name)
+			if err != nil || info.IsDir() {
+				// the file might have been removed between glob and stat
+				continue
+			}
+
+			var previous *digest.File
+			if file, ok := poller.files[name]; ok {
+				previous = &file
+			}
+
+			// only reads the file content if its metadata changed
+			file, err := digest.NewFile(filepath.Join(poller.cwd, name), previous)
+			if err != nil {
+				continue
+			}
+
+			files[name] = file
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,59 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPollerChanges(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	write := func(name, content string) {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("a.go", "package a")
+	write("b.go", "package b")
+	write("c.txt", "ignored")
+	poller, err := NewPoller(dir, []string{"**/*.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// act: touching a file without changing its content is not a change
+	later := time.Now().Add(time.Minute)
+	err = os.Chtimes(filepath.Join(dir, "a.go"), later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write("b.go", "package bb")
+	write("c.txt", "still ignored")
+	write("d.go", "package d")
+	changed, err := poller.Poll()
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"b.go", "d.go"}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Errorf("expected %v to change but got %v", expected, changed)
+	}
+
+	// act: nothing changed since the last poll
+	changed, err = poller.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changed) != 0 {
+		t.Errorf("expected no changes but got %v", changed)
+	}
+}